@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const defaultAlertCooldown = 900 // seconds
+
+// alertState is what we remember about a server between polls so we only
+// alert on transitions, not every time we see a busy server.
+type alertState struct {
+	armed     bool      // player count has been below the threshold
+	lastMatch string    // time_remaining from the previous poll
+	lastAlert time.Time // when we last posted anything for this server
+}
+
+var (
+	alerts   = map[string]*alertState{} // keyed by server alias
+	alertsMu sync.Mutex
+)
+
+// checkAlerts will look at the latest poll of a server and post to its alert
+// channels if enough players have shown up or a match has just started.
+func checkAlerts(s *discordgo.Session, p serverPoll) {
+	srv := p.server
+	if len(srv.GetAlertChannels()) == 0 || p.err != nil {
+		return
+	}
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+	st, ok := alerts[srv.GetAlias()]
+	if !ok {
+		// Don't alert on the first poll after starting, we don't know what
+		// changed.
+		st = &alertState{lastMatch: p.info.Server["time_remaining"]}
+		alerts[srv.GetAlias()] = st
+	}
+
+	var msg string
+	players, _ := strconv.Atoi(p.info.Server["player_count"])
+	threshold := int(srv.GetAlertPlayers())
+	if threshold > 0 {
+		if players < threshold {
+			st.armed = true
+		} else if st.armed {
+			st.armed = false
+			msg = fmt.Sprintf("**%s** has %d players, a game is forming!", srv.GetAlias(), players)
+		}
+	}
+	match := p.info.Server["time_remaining"]
+	if srv.GetAlertMatchStart() && st.lastMatch == "WARMUP" && match != "" && match != "WARMUP" {
+		msg = fmt.Sprintf("A match just started on **%s** (%d players)", srv.GetAlias(), players)
+	}
+	st.lastMatch = match
+	if msg == "" {
+		return
+	}
+
+	cooldown := time.Duration(srv.GetAlertCooldown()) * time.Second
+	if cooldown <= 0 {
+		cooldown = defaultAlertCooldown * time.Second
+	}
+	if time.Since(st.lastAlert) < cooldown {
+		return
+	}
+	st.lastAlert = time.Now()
+	msg = fmt.Sprintf("%s `%s`", msg, srv.GetAddress())
+	for _, ch := range srv.GetAlertChannels() {
+		send := statusMessage(ch, p.info)
+		if send.Content != "" {
+			send.Content = msg + "\n" + send.Content
+		} else {
+			send.Content = msg
+		}
+		_, err := s.ChannelMessageSendComplex(ch, send)
+		if err != nil {
+			log.Printf("error sending alert for %q to %s: %v\n", srv.GetAlias(), ch, err)
+		}
+	}
+}
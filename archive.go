@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/packetflinger/libq2/pak"
+	"github.com/packetflinger/libq2/proto"
+)
+
+// An AssetArchive is an upload of game files (a .pak, .zip, or just a map)
+// we can take assets from. Every format goes through the same checks and is
+// committed the same way, see FileUpload.process, each just has to say
+// what's in it and read a file back out.
+type AssetArchive interface {
+	// Entries lists everything in the archive, in the order it's stored.
+	Entries() []ArchiveEntry
+	// Open reads the contents of the entry called name.
+	Open(name string) (io.ReadCloser, error)
+	// Size is how big the archive itself is.
+	Size() int64
+	Close() error
+}
+
+// ArchiveEntry is a file (or directory) inside an AssetArchive, as the
+// archive describes it.
+type ArchiveEntry struct {
+	Name       string // slash separated path
+	Size       int64  // uncompressed
+	Compressed int64
+	Dir        bool
+	Symlink    bool
+	Path       string   // if the entry is already a file on disk, where
+	Sum        [32]byte // sha256 of the contents, if Hashed
+	Hashed     bool
+}
+
+// openAssetArchive opens an upload as whichever kind of archive its
+// extension (one of fileTypes) says it is. name and sum are the upload's,
+// used for a map on its own. Everything read from it counts towards the
+// uncompressed size limit.
+func openAssetArchive(extension, filename, name string, sum [32]byte) (AssetArchive, error) {
+	var archive AssetArchive
+	var err error
+	switch extension {
+	case ".bsp":
+		archive, err = openBSP(filename, name, sum)
+	case ".pak":
+		archive, err = openPAK(filename)
+	case ".zip", ".pkz", ".pk3":
+		archive, err = openZIP(filename)
+	case ".7z":
+		archive, err = open7Z(filename)
+	default:
+		return nil, fmt.Errorf("unsupported file type %q", extension)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return limitArchive(archive), nil
+}
+
+// bspArchive is a map uploaded on its own, it's treated as an archive with
+// just the map in maps/. The download is used as it is, it was hashed on
+// the way in.
+type bspArchive struct {
+	filename string
+	entry    ArchiveEntry
+}
+
+func openBSP(filename, name string, sum [32]byte) (*bspArchive, error) {
+	st, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &bspArchive{
+		filename: filename,
+		entry: ArchiveEntry{
+			Name:       path.Join("maps", name),
+			Size:       st.Size(),
+			Compressed: st.Size(),
+			Path:       filename,
+			Sum:        sum,
+			Hashed:     true,
+		},
+	}, nil
+}
+
+func (a *bspArchive) Entries() []ArchiveEntry {
+	return []ArchiveEntry{a.entry}
+}
+
+func (a *bspArchive) Open(name string) (io.ReadCloser, error) {
+	if name != a.entry.Name {
+		return nil, fmt.Errorf("%q not in upload", name)
+	}
+	return os.Open(a.filename)
+}
+
+func (a *bspArchive) Size() int64 {
+	return a.entry.Size
+}
+
+func (a *bspArchive) Close() error {
+	return nil
+}
+
+// pakArchive is a Quake 2 .pak, the whole thing is read into memory.
+type pakArchive struct {
+	files map[string]*proto.PAKFile
+	list  []ArchiveEntry
+	size  int64
+}
+
+func openPAK(filename string) (a *pakArchive, err error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// the pak reader trusts the header, a truncated file or bad offsets
+	// panic rather than failing. Without the spare capacity ReadFile leaves,
+	// offsets past the end can't quietly read zeros either.
+	data = data[:len(data):len(data)]
+	defer func() {
+		if r := recover(); r != nil {
+			a, err = nil, fmt.Errorf("invalid pak file: %v", r)
+		}
+	}()
+	pakfile, err := pak.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pak file: %v", err)
+	}
+	a = &pakArchive{files: map[string]*proto.PAKFile{}, size: int64(len(data))}
+	for _, pf := range pakfile.GetFiles() {
+		a.files[pf.GetName()] = pf
+		// paks aren't compressed
+		size := int64(len(pf.GetData()))
+		a.list = append(a.list, ArchiveEntry{Name: pf.GetName(), Size: size, Compressed: size})
+	}
+	return a, nil
+}
+
+func (a *pakArchive) Entries() []ArchiveEntry {
+	return a.list
+}
+
+func (a *pakArchive) Open(name string) (io.ReadCloser, error) {
+	pf, ok := a.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%q not in pak", name)
+	}
+	return io.NopCloser(bytes.NewReader(pf.GetData())), nil
+}
+
+func (a *pakArchive) Size() int64 {
+	return a.size
+}
+
+func (a *pakArchive) Close() error {
+	return nil
+}
+
+// sevenZipArchive is a .7z. Names can be stored with Windows separators,
+// they're converted so they get the same checks as any other archive.
+type sevenZipArchive struct {
+	rc    *sevenzip.ReadCloser
+	size  int64
+	files map[string]*sevenzip.File
+}
+
+func open7Z(filename string) (a *sevenZipArchive, err error) {
+	st, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	// the 7z reader can panic on a malformed header rather than failing
+	defer func() {
+		if r := recover(); r != nil {
+			a, err = nil, fmt.Errorf("invalid 7z file: %v", r)
+		}
+	}()
+	rc, err := sevenzip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	a = &sevenZipArchive{rc: rc, size: st.Size(), files: map[string]*sevenzip.File{}}
+	for _, sf := range rc.File {
+		a.files[sevenZipName(sf)] = sf
+	}
+	return a, nil
+}
+
+func sevenZipName(sf *sevenzip.File) string {
+	return strings.ReplaceAll(sf.Name, "\\", "/")
+}
+
+// Entries for a 7z don't have their own compressed size, files are usually
+// compressed together. Each is given its share of the archive so the
+// compression ratio limit applies to the archive as a whole.
+func (a *sevenZipArchive) Entries() []ArchiveEntry {
+	var total float64
+	for _, sf := range a.rc.File {
+		total += float64(sf.UncompressedSize)
+	}
+	var list []ArchiveEntry
+	for _, sf := range a.rc.File {
+		size := declaredSize(sf.UncompressedSize)
+		compressed := size
+		if total > 0 {
+			compressed = int64(float64(a.Size()) * float64(sf.UncompressedSize) / total)
+		}
+		mode := sf.Mode()
+		list = append(list, ArchiveEntry{
+			Name:       sevenZipName(sf),
+			Size:       size,
+			Compressed: compressed,
+			Dir:        mode.IsDir(),
+			Symlink:    mode&os.ModeSymlink != 0,
+		})
+	}
+	return list
+}
+
+func (a *sevenZipArchive) Open(name string) (io.ReadCloser, error) {
+	sf, ok := a.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%q not in 7z", name)
+	}
+	return sf.Open()
+}
+
+func (a *sevenZipArchive) Size() int64 {
+	return a.size
+}
+
+func (a *sevenZipArchive) Close() error {
+	return a.rc.Close()
+}
+
+// hashEntry returns the sha256 of the contents of a file in an archive.
+func hashEntry(archive AssetArchive, name string) ([32]byte, error) {
+	var sum [32]byte
+	fp, err := archive.Open(name)
+	if err != nil {
+		return sum, fmt.Errorf("error opening %q in archive: %v", name, err)
+	}
+	defer fp.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, limitReader(fp, maxFileBytes(), name)); err != nil {
+		return sum, fmt.Errorf("error reading %q from archive: %w", name, err)
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// Write a single file from inside an archive to the local git repo (or
+// staging), at fullpath.
+func writeEntryToRepo(archive AssetArchive, name, fullpath string) error {
+	err := os.MkdirAll(filepath.Dir(fullpath), 0755)
+	if err != nil {
+		return fmt.Errorf("error creating full path: %v", err)
+	}
+	fp, err := archive.Open(name)
+	if err != nil {
+		return fmt.Errorf("error opening %q in archive: %v", name, err)
+	}
+	defer fp.Close()
+
+	dstFile, err := os.OpenFile(fullpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening destination file: %v", err)
+	}
+	defer dstFile.Close()
+
+	if _, err := io.Copy(dstFile, limitReader(fp, maxFileBytes(), name)); err != nil {
+		return fmt.Errorf("error copying %q from archive: %w", name, err)
+	}
+	return nil
+}
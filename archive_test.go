@@ -0,0 +1,315 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// testFile is a file to put in a test archive. Names ending in "/" are
+// directories.
+type testFile struct {
+	name string
+	data string
+}
+
+func writeTestZip(t *testing.T, name string, files []testFile) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestPAK writes a Quake 2 pak: header, file data, then the directory
+// of 64 byte entries (56 byte name, offset, length).
+func writeTestPAK(t *testing.T, name string, files []testFile) {
+	t.Helper()
+	le := binary.LittleEndian
+	var data, dir []byte
+	for _, f := range files {
+		if strings.HasSuffix(f.name, "/") {
+			continue
+		}
+		entry := make([]byte, 64)
+		copy(entry, f.name)
+		le.PutUint32(entry[56:], uint32(12+len(data)))
+		le.PutUint32(entry[60:], uint32(len(f.data)))
+		dir = append(dir, entry...)
+		data = append(data, f.data...)
+	}
+	header := make([]byte, 12)
+	copy(header, "PACK")
+	le.PutUint32(header[4:], uint32(12+len(data)))
+	le.PutUint32(header[8:], uint32(len(dir)))
+	out := append(append(header, data...), dir...)
+	if err := os.WriteFile(name, out, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestBSP writes a single file, the contents don't have to be a map
+// for anything that doesn't parse it.
+func writeTestBSP(t *testing.T, name string, files []testFile) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(files[0].data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTest7Z writes a 7z archive with everything stored uncompressed (the
+// "copy" method) in a single folder, and a plain header.
+func writeTest7Z(t *testing.T, name string, files []testFile) {
+	t.Helper()
+	num := func(v uint64) []byte {
+		for n := 0; n < 8; n++ {
+			if v < 1<<(7*(n+1)) {
+				out := []byte{byte(uint(0xff)<<(8-n)) | byte(v>>(8*n))}
+				for i := 0; i < n; i++ {
+					out = append(out, byte(v>>(8*i)))
+				}
+				return out
+			}
+		}
+		out := []byte{0xff}
+		return binary.LittleEndian.AppendUint64(out, v)
+	}
+
+	var packed []byte
+	var sizes []uint64
+	var empty []bool
+	var names []byte
+	var attrs []byte
+	for _, f := range files {
+		dir := strings.HasSuffix(f.name, "/")
+		empty = append(empty, dir)
+		attr := uint32(0x20) // archive
+		if dir {
+			attr = 0x10
+		} else {
+			packed = append(packed, f.data...)
+			sizes = append(sizes, uint64(len(f.data)))
+		}
+		attrs = binary.LittleEndian.AppendUint32(attrs, attr)
+		for _, c := range utf16.Encode([]rune(strings.TrimSuffix(f.name, "/"))) {
+			names = binary.LittleEndian.AppendUint16(names, c)
+		}
+		names = append(names, 0, 0)
+	}
+
+	var h []byte
+	h = append(h, 0x01, 0x04)             // header, main streams info
+	h = append(h, 0x06, 0x00, 0x01, 0x09) // pack info: at 0, one stream, sizes
+	h = append(h, num(uint64(len(packed)))...)
+	h = append(h, 0x00)                   // end
+	h = append(h, 0x07, 0x0b, 0x01, 0x00) // unpack info, folder, one, not external
+	h = append(h, 0x01, 0x01, 0x00)       // one coder, 1 byte id, copy
+	h = append(h, 0x0c)                   // unpack sizes
+	h = append(h, num(uint64(len(packed)))...)
+	h = append(h, 0x00)       // end
+	h = append(h, 0x08, 0x0d) // substreams info, number of streams
+	h = append(h, num(uint64(len(sizes)))...)
+	if len(sizes) > 1 {
+		h = append(h, 0x09)
+		for _, s := range sizes[:len(sizes)-1] {
+			h = append(h, num(s)...)
+		}
+	}
+	h = append(h, 0x0a, 0x01) // digests, all defined
+	for _, f := range files {
+		if !strings.HasSuffix(f.name, "/") {
+			h = binary.LittleEndian.AppendUint32(h, crc32.ChecksumIEEE([]byte(f.data)))
+		}
+	}
+	h = append(h, 0x00, 0x00) // end substreams, end streams
+
+	h = append(h, 0x05)
+	h = append(h, num(uint64(len(files)))...)
+	var bits []byte
+	for i, e := range empty {
+		if i%8 == 0 {
+			bits = append(bits, 0)
+		}
+		if e {
+			bits[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	h = append(h, 0x0e)
+	h = append(h, num(uint64(len(bits)))...)
+	h = append(h, bits...)
+	h = append(h, 0x11)
+	h = append(h, num(uint64(len(names)+1))...)
+	h = append(h, 0x00)
+	h = append(h, names...)
+	h = append(h, 0x15)
+	h = append(h, num(uint64(len(attrs)+2))...)
+	h = append(h, 0x01, 0x00)
+	h = append(h, attrs...)
+	h = append(h, 0x00, 0x00) // end files info, end header
+
+	start := make([]byte, 20)
+	binary.LittleEndian.PutUint64(start[0:], uint64(len(packed)))
+	binary.LittleEndian.PutUint64(start[8:], uint64(len(h)))
+	binary.LittleEndian.PutUint32(start[16:], crc32.ChecksumIEEE(h))
+	sig := []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c, 0, 4}
+	sig = binary.LittleEndian.AppendUint32(sig, crc32.ChecksumIEEE(start))
+
+	out := append(append(append(sig, start...), packed...), h...)
+	if err := os.WriteFile(name, out, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAssetArchives(t *testing.T) {
+	files := []testFile{
+		{name: "maps/"},
+		{name: "maps/test.bsp", data: "not really a map"},
+		{name: "textures/e1u1/floor.wal", data: "a texture"},
+	}
+	tests := []struct {
+		ext   string
+		write func(*testing.T, string, []testFile)
+		files []testFile
+		want  []string // entries that aren't directories
+		dirs  bool     // whether directories are listed
+	}{
+		{ext: ".bsp", write: writeTestBSP, files: files[1:2], want: []string{"maps/test.bsp"}},
+		{ext: ".pak", write: writeTestPAK, files: files, want: []string{"maps/test.bsp", "textures/e1u1/floor.wal"}},
+		{ext: ".zip", write: writeTestZip, files: files, want: []string{"maps/test.bsp", "textures/e1u1/floor.wal"}, dirs: true},
+		{ext: ".pk3", write: writeTestZip, files: files, want: []string{"maps/test.bsp", "textures/e1u1/floor.wal"}, dirs: true},
+		{ext: ".7z", write: writeTest7Z, files: files, want: []string{"maps/test.bsp", "textures/e1u1/floor.wal"}, dirs: true},
+	}
+	contents := map[string]string{}
+	for _, f := range files {
+		contents[f.name] = f.data
+	}
+	for _, tc := range tests {
+		t.Run(tc.ext, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "upload"+tc.ext)
+			tc.write(t, filename, tc.files)
+			st, err := os.Stat(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum := sha256.Sum256([]byte(tc.files[0].data))
+			archive, err := openAssetArchive(tc.ext, filename, "test.bsp", sum)
+			if err != nil {
+				t.Fatalf("openAssetArchive() error: %v", err)
+			}
+			defer archive.Close()
+
+			if archive.Size() != st.Size() {
+				t.Errorf("Size() = %d, want %d", archive.Size(), st.Size())
+			}
+			var got []string
+			var sawDir bool
+			for _, e := range archive.Entries() {
+				if e.Dir {
+					sawDir = true
+					if !strings.HasSuffix(e.Name, "/") {
+						t.Errorf("directory %q doesn't end in /", e.Name)
+					}
+					continue
+				}
+				got = append(got, e.Name)
+				if e.Size != int64(len(contents[e.Name])) {
+					t.Errorf("%q size = %d, want %d", e.Name, e.Size, len(contents[e.Name]))
+				}
+				if e.Size > 0 && e.Compressed <= 0 {
+					t.Errorf("%q compressed size = %d", e.Name, e.Compressed)
+				}
+				fp, err := archive.Open(e.Name)
+				if err != nil {
+					t.Fatalf("Open(%q) error: %v", e.Name, err)
+				}
+				data, err := io.ReadAll(fp)
+				fp.Close()
+				if err != nil {
+					t.Fatalf("reading %q: %v", e.Name, err)
+				}
+				if string(data) != contents[e.Name] {
+					t.Errorf("%q contents = %q, want %q", e.Name, data, contents[e.Name])
+				}
+				if e.Hashed && e.Sum != sha256.Sum256(data) {
+					t.Errorf("%q sum doesn't match its contents", e.Name)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("Entries() = %q, want %q", got, tc.want)
+			}
+			if sawDir != tc.dirs {
+				t.Errorf("directories listed = %v, want %v", sawDir, tc.dirs)
+			}
+			if _, err := archive.Open("maps/missing.bsp"); err == nil {
+				t.Errorf("Open() of a missing entry didn't fail")
+			}
+		})
+	}
+}
+
+func TestAssetArchiveInvalid(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "junk")
+	if err := os.WriteFile(filename, []byte("this isn't an archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range []string{".pak", ".zip", ".pk3", ".7z"} {
+		if _, err := openAssetArchive(ext, filename, "junk", [32]byte{}); err == nil {
+			t.Errorf("openAssetArchive(%q) of junk didn't fail", ext)
+		}
+	}
+}
+
+// A pak with a header promising more than is there.
+func TestAssetArchiveTruncatedPAK(t *testing.T) {
+	dir := t.TempDir()
+	full := filepath.Join(dir, "full.pak")
+	writeTestPAK(t, full, []testFile{{name: "maps/test.bsp", data: "not really a map"}})
+	data, err := os.ReadFile(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, 12)
+	copy(header, "PACK")
+	binary.LittleEndian.PutUint32(header[4:], 1000)
+	binary.LittleEndian.PutUint32(header[8:], 64)
+
+	for name, contents := range map[string][]byte{
+		"too short":      data[:8],
+		"header only":    data[:12],
+		"cut short":      data[:len(data)-10],
+		"bad dir offset": header,
+	} {
+		filename := filepath.Join(dir, "upload.pak")
+		if err := os.WriteFile(filename, contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+		archive, err := openAssetArchive(".pak", filename, "upload.pak", [32]byte{})
+		if err == nil {
+			t.Errorf("%s: openAssetArchive() didn't fail", name)
+		}
+		if archive != nil {
+			archive.Close()
+		}
+	}
+}
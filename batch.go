@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// uploadBatch collects the files from every attachment in a message, so
+// they go into the repo as a single commit.
+type uploadBatch struct {
+	mu      sync.Mutex
+	uploads []*batchedUpload
+}
+
+// batchedUpload is an attachment whose files have been written to the repo
+// and are waiting to be committed.
+type batchedUpload struct {
+	upload   *FileUpload
+	pm       *discordgo.Channel // uploader's DMs
+	files    []string           // paths in the repo
+	size     int64
+	report   string // sent to the uploader once committed
+	previews []*discordgo.File
+}
+
+func (b *uploadBatch) add(u *batchedUpload) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.uploads = append(b.uploads, u)
+}
+
+// commit everything in the batch and let the uploader know.
+func (b *uploadBatch) commit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.uploads) == 0 {
+		return
+	}
+	first := b.uploads[0].upload
+	author := first.message.Author
+	var names, files []string
+	for _, u := range b.uploads {
+		names = append(names, u.upload.name)
+		files = append(files, u.files...)
+	}
+	msg := fmt.Sprintf("Added %s, submitted by %s[%s]", strings.Join(names, ", "), author.Username, author.ID)
+	commit, prURL, err := commitUpload(&commitRequest{
+		session:  first.session,
+		message:  msg,
+		author:   commitAuthor(author.Username, author.ID),
+		username: author.Username,
+		filename: first.name,
+		files:    files,
+	})
+	if err != nil && !errors.Is(err, errPushPending) {
+		log.Println("git error:", err)
+		for _, u := range b.uploads {
+			u.upload.session.ChannelMessageSend(u.pm.ID, fmt.Sprintf("Sorry, `%s` passed all the checks but I couldn't commit it. The admins have been told.", u.upload.name))
+		}
+		return
+	}
+	for _, u := range b.uploads {
+		u.upload.recordUpload(u.files, u.size, commit)
+		report := u.report
+		if prURL != "" {
+			report += "\nPull request: " + prURL
+		}
+		if err != nil {
+			report += "\n" + pushPendingNote
+		}
+		u.upload.session.ChannelMessageSend(u.pm.ID, report)
+		u.upload.postPreviews(u.previews, prURL)
+		log.Printf("%q committed to git repo", u.upload.name)
+	}
+	b.uploads = nil
+}
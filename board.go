@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// updateStatusBoard keeps one message per configured server in the board
+// channel up to date with that server's current status. Existing messages
+// are edited in place rather than posting new ones, and their IDs are saved
+// so a restart picks up the same messages.
+func updateStatusBoard(s *discordgo.Session, p serverPoll) {
+	if config.GetBoardChannel() == "" {
+		return
+	}
+	msg := boardStatus(p)
+	err := updateBoardMessage(s, p.server.GetAlias(), msg)
+	if err != nil {
+		log.Printf("error updating status board for %q: %v\n", p.server.GetAlias(), err)
+	}
+}
+
+// boardStatus builds a single server's board message.
+func boardStatus(p serverPoll) *discordgo.MessageSend {
+	srv := p.server
+	if p.err != nil {
+		return &discordgo.MessageSend{
+			Content: fmt.Sprintf("**%s** (`%s`) is not responding", srv.GetAlias(), srv.GetAddress()),
+		}
+	}
+	msg := statusMessage(config.GetBoardChannel(), p.info)
+	if len(msg.Embeds) > 0 {
+		msg.Embeds[0].Footer = &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("%s • %s", srv.GetAlias(), srv.GetAddress()),
+		}
+		msg.Embeds[0].Timestamp = time.Now().Format(time.RFC3339)
+	} else {
+		msg.Content = fmt.Sprintf("**%s** `%s`\n%s\n_updated <t:%d:R>_", srv.GetAlias(), srv.GetAddress(), msg.Content, time.Now().Unix())
+	}
+	return msg
+}
+
+// updateBoardMessage edits the existing board message for a server, or posts
+// (and pins) a new one if we don't have one or it's been deleted.
+func updateBoardMessage(s *discordgo.Session, alias string, content *discordgo.MessageSend) error {
+	channel := config.GetBoardChannel()
+	id, err := store.MessageID(boardMessageKey(alias))
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		// always set both so switching between text and embed (a server
+		// going down) clears out whatever was there before.
+		edit := discordgo.NewMessageEdit(channel, id).SetContent(content.Content)
+		edit.Embeds = content.Embeds
+		if edit.Embeds == nil {
+			edit.Embeds = []*discordgo.MessageEmbed{}
+		}
+		_, err := s.ChannelMessageEditComplex(edit)
+		if err == nil {
+			return nil
+		}
+		log.Printf("unable to edit board message %s, posting a new one: %v\n", id, err)
+	}
+	msg, err := s.ChannelMessageSendComplex(channel, content)
+	if err != nil {
+		return err
+	}
+	if err := s.ChannelMessagePin(channel, msg.ID); err != nil {
+		log.Printf("unable to pin board message %s: %v\n", msg.ID, err)
+	}
+	return store.SetMessageID(boardMessageKey(alias), msg.ID)
+}
+
+// The key the board message ID for a server is stored under.
+func boardMessageKey(alias string) string {
+	return "board/" + alias
+}
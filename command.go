@@ -0,0 +1,453 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+// A command is a single bot action. Every command is reachable two ways: as
+// a text message ("!q2 status host:port") and as a Discord slash command
+// ("/q2 status server:host:port"). Both paths are turned into a
+// commandRequest and handed to the same handler.
+type command struct {
+	group       string // top-level name, "q2" for "!q2" and "/q2"
+	name        string // subcommand name
+	description string
+	isDefault   bool // used when the text form omits the subcommand name
+	options     []*discordgo.ApplicationCommandOption
+	channels    func() []string // where this command is allowed
+	capability  pb.Capability   // what the user needs to be allowed to run it
+	handler     func(*commandRequest)
+}
+
+// commandRequest is everything a handler needs to know about who asked for
+// what and where, regardless of whether it came from a text message or an
+// interaction.
+type commandRequest struct {
+	session     *discordgo.Session
+	channelID   string
+	guildID     string
+	user        *discordgo.User
+	member      *discordgo.Member // nil outside of guilds
+	args        []string
+	interaction *discordgo.Interaction // nil for text commands
+
+	mu      sync.Mutex
+	replied bool
+}
+
+// All the commands the bot knows about, in the order they'll be registered.
+var commands = []*command{
+	{
+		group:       "q2",
+		name:        "status",
+		description: "Show the status of a Quake 2 server",
+		isDefault:   true,
+		options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "server",
+				Description: "Server alias or address (host:port)",
+			},
+		},
+		channels:   func() []string { return config.GetStatusChannels() },
+		capability: pb.Capability_STATUS,
+		handler:    cmdServerStatus,
+	},
+	{
+		group:       "q2",
+		name:        "players",
+		description: "List the players on a Quake 2 server",
+		options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "server",
+				Description: "Server alias or address (host:port)",
+				Required:    true,
+			},
+		},
+		channels:   func() []string { return config.GetStatusChannels() },
+		capability: pb.Capability_STATUS,
+		handler:    cmdServerPlayers,
+	},
+	{
+		group:       "q2",
+		name:        "servers",
+		description: "List the servers you can ask about by name",
+		channels:    func() []string { return config.GetStatusChannels() },
+		capability:  pb.Capability_STATUS,
+		handler:     cmdServerList,
+	},
+	{
+		group:       "q2",
+		name:        "watch",
+		description: "Get a DM when a player joins one of our servers",
+		options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "player",
+				Description: "Player name",
+				Required:    true,
+			},
+		},
+		channels:   func() []string { return config.GetStatusChannels() },
+		capability: pb.Capability_STATUS,
+		handler:    cmdWatch,
+	},
+	{
+		group:       "q2",
+		name:        "unwatch",
+		description: "Stop watching for a player",
+		options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "player",
+				Description: "Player name",
+				Required:    true,
+			},
+		},
+		channels:   func() []string { return config.GetStatusChannels() },
+		capability: pb.Capability_STATUS,
+		handler:    cmdUnwatch,
+	},
+	{
+		group:       "q2",
+		name:        "watching",
+		description: "List the players you're watching for",
+		channels:    func() []string { return config.GetStatusChannels() },
+		capability:  pb.Capability_STATUS,
+		handler:     cmdWatching,
+	},
+	{
+		group:       "maps",
+		name:        "recent",
+		description: "List the most recent map uploads",
+		isDefault:   true,
+		options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "count",
+				Description: "How many uploads to list",
+			},
+		},
+		channels:   func() []string { return config.GetMapChannels() },
+		capability: pb.Capability_STATUS,
+		handler:    cmdMapsRecent,
+	},
+	{
+		group:       "maps",
+		name:        "by",
+		description: "List the uploads from a user",
+		options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "Who uploaded",
+				Required:    true,
+			},
+		},
+		channels:   func() []string { return config.GetMapChannels() },
+		capability: pb.Capability_STATUS,
+		handler:    cmdMapsBy,
+	},
+	{
+		group:       "maps",
+		name:        "search",
+		description: "Find maps in the repo",
+		options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "pattern",
+				Description: "Part of the map name, or a wildcard pattern like q2dm*",
+				Required:    true,
+			},
+		},
+		channels:   func() []string { return config.GetMapChannels() },
+		capability: pb.Capability_STATUS,
+		handler:    cmdMapsSearch,
+	},
+	{
+		group:       "maps",
+		name:        "info",
+		description: "Show the details of a map in the repo",
+		options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "name",
+				Description: "Map name",
+				Required:    true,
+			},
+		},
+		channels:   func() []string { return config.GetMapChannels() },
+		capability: pb.Capability_STATUS,
+		handler:    cmdMapsInfo,
+	},
+	{
+		group:       "maps",
+		name:        "delete",
+		description: "Remove a map from the repo",
+		options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "name",
+				Description: "Map name",
+				Required:    true,
+			},
+		},
+		channels:   func() []string { return config.GetMapChannels() },
+		capability: pb.Capability_DELETE,
+		handler:    cmdMapsDelete,
+	},
+	{
+		group:       "maps",
+		name:        "queue",
+		description: "Show the uploads waiting to be added to the repo",
+		channels:    func() []string { return config.GetMapChannels() },
+		capability:  pb.Capability_STATUS,
+		handler:     cmdMapsQueue,
+	},
+}
+
+// slash commands we've registered with Discord, removed again at shutdown.
+var registeredCommands []registeredCommand
+
+type registeredCommand struct {
+	guildID string
+	cmd     *discordgo.ApplicationCommand
+}
+
+// findCommand will look up a command by group and subcommand name. If the
+// name doesn't match any subcommand, the default one for the group is
+// returned and ok is false so the caller knows the name is really an
+// argument.
+func findCommand(group, name string) (cmd *command, ok bool) {
+	var def *command
+	for _, c := range commands {
+		if c.group != group {
+			continue
+		}
+		if c.name == name {
+			return c, true
+		}
+		if c.isDefault {
+			def = c
+		}
+	}
+	return def, false
+}
+
+// dispatchText will parse a "!group [subcommand] [args...]" message and run
+// the matching command. Returns false if the message isn't a command.
+func dispatchText(s *discordgo.Session, m *discordgo.MessageCreate) bool {
+	if !strings.HasPrefix(m.Content, "!") {
+		return false
+	}
+	fields := strings.Fields(m.Content[1:])
+	if len(fields) == 0 {
+		return false
+	}
+	group, args := fields[0], fields[1:]
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+	cmd, ok := findCommand(group, name)
+	if cmd == nil {
+		return false
+	}
+	if ok {
+		args = args[1:]
+	}
+	if !contains(m.ChannelID, cmd.channels()) {
+		return false
+	}
+	req := &commandRequest{
+		session:   s,
+		channelID: m.ChannelID,
+		guildID:   m.GuildID,
+		user:      m.Author,
+		member:    m.Member,
+		args:      args,
+	}
+	go func() {
+		if !authorized(s, m.GuildID, m.Author.ID, m.Member, cmd.capability) {
+			req.reply(denied(cmd.capability))
+			return
+		}
+		cmd.handler(req)
+	}()
+	return true
+}
+
+// handleInteraction is called for every interaction (slash command) event.
+func handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 || data.Options[0].Type != discordgo.ApplicationCommandOptionSubCommand {
+		return
+	}
+	sub := data.Options[0]
+	cmd, ok := findCommand(data.Name, sub.Name)
+	if !ok {
+		return
+	}
+	user := i.User
+	if i.Member != nil {
+		user = i.Member.User
+	}
+	if !contains(i.ChannelID, cmd.channels()) {
+		respondEphemeral(s, i.Interaction, "That command isn't available in this channel.")
+		return
+	}
+	if !authorized(s, i.GuildID, user.ID, i.Member, cmd.capability) {
+		respondEphemeral(s, i.Interaction, denied(cmd.capability))
+		return
+	}
+	var args []string
+	for _, o := range sub.Options {
+		args = append(args, fmt.Sprint(o.Value))
+	}
+
+	// Handlers usually need to talk to a game server or the filesystem, which
+	// can easily take longer than Discord's 3 second deadline. Acknowledge
+	// now and fill in the response when the handler replies.
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Println("error acknowledging interaction:", err)
+		return
+	}
+	req := &commandRequest{
+		session:     s,
+		channelID:   i.ChannelID,
+		guildID:     i.GuildID,
+		user:        user,
+		member:      i.Member,
+		args:        args,
+		interaction: i.Interaction,
+	}
+	go cmd.handler(req)
+}
+
+// respondEphemeral answers an interaction with a message only the user who
+// asked can see.
+func respondEphemeral(s *discordgo.Session, i *discordgo.Interaction, content string) {
+	err := s.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   uint64(discordgo.MessageFlagsEphemeral),
+		},
+	})
+	if err != nil {
+		log.Println("error responding to interaction:", err)
+	}
+}
+
+// reply sends a plain text response to wherever the command came from.
+func (r *commandRequest) reply(content string) {
+	r.replyComplex(&discordgo.MessageSend{Content: content})
+}
+
+// replyComplex sends a response that may include embeds or files. For slash
+// commands the first reply fills in the deferred response and any further
+// replies are sent as followups.
+func (r *commandRequest) replyComplex(msg *discordgo.MessageSend) {
+	if r.interaction == nil {
+		_, err := r.session.ChannelMessageSendComplex(r.channelID, msg)
+		if err != nil {
+			log.Println("error sending reply:", err)
+		}
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	if !r.replied {
+		_, err = r.session.InteractionResponseEdit(r.interaction, &discordgo.WebhookEdit{
+			Content: msg.Content,
+			Embeds:  msg.Embeds,
+			Files:   msg.Files,
+		})
+		r.replied = true
+	} else {
+		_, err = r.session.FollowupMessageCreate(r.interaction, true, &discordgo.WebhookParams{
+			Content: msg.Content,
+			Embeds:  msg.Embeds,
+			Files:   msg.Files,
+		})
+	}
+	if err != nil {
+		log.Println("error sending interaction reply:", err)
+	}
+}
+
+// applicationCommands converts our command list into the nested structure
+// Discord wants: one top-level command per group, each command in the group
+// as a subcommand.
+func applicationCommands() []*discordgo.ApplicationCommand {
+	var out []*discordgo.ApplicationCommand
+	groups := map[string]*discordgo.ApplicationCommand{}
+	for _, c := range commands {
+		ac, ok := groups[c.group]
+		if !ok {
+			ac = &discordgo.ApplicationCommand{
+				Name:        c.group,
+				Description: c.group + " commands",
+			}
+			groups[c.group] = ac
+			out = append(out, ac)
+		}
+		ac.Options = append(ac.Options, &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        c.name,
+			Description: c.description,
+			Options:     c.options,
+		})
+	}
+	return out
+}
+
+// registerCommands will create our slash commands with Discord. If the config
+// lists any guilds they're registered in each of those (which is immediate),
+// otherwise they're registered globally (which can take a while to show up).
+func registerCommands(s *discordgo.Session) {
+	if !config.GetSlashCommands() {
+		return
+	}
+	guilds := config.GetCommandGuilds()
+	if len(guilds) == 0 {
+		guilds = []string{""}
+	}
+	for _, g := range guilds {
+		for _, ac := range applicationCommands() {
+			cmd, err := s.ApplicationCommandCreate(s.State.User.ID, g, ac)
+			if err != nil {
+				log.Printf("unable to register /%s command (guild %q): %v\n", ac.Name, g, err)
+				continue
+			}
+			registeredCommands = append(registeredCommands, registeredCommand{guildID: g, cmd: cmd})
+		}
+	}
+	log.Printf("registered %d slash commands\n", len(registeredCommands))
+}
+
+// unregisterCommands removes any slash commands we created at startup.
+func unregisterCommands(s *discordgo.Session) {
+	for _, rc := range registeredCommands {
+		err := s.ApplicationCommandDelete(s.State.User.ID, rc.guildID, rc.cmd.ID)
+		if err != nil {
+			log.Printf("unable to remove /%s command: %v\n", rc.cmd.Name, err)
+		}
+	}
+	registeredCommands = nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+	"github.com/packetflinger/libq2/bsp"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+// The six sides of a skybox, each is a separate image in env/
+var skySides = []string{"rt", "bk", "lf", "ft", "up", "dn"}
+
+// Formats a wall texture can be in. Maps name .wal textures, clients that
+// support them load .png/.tga/.jpg replacements instead.
+var textureExts = []string{".wal", ".png", ".tga", ".jpg"}
+
+// An assetRef is a file a map needs at runtime. Some assets can come in more
+// than one format (skies can be .tga or .pcx), having any one of the paths
+// is enough.
+type assetRef struct {
+	paths []string // relative to the game directory
+}
+
+// mapAssets returns everything a map references outside itself: wall
+// textures, the sky, and any sounds or models named in the entities.
+func mapAssets(bspfile *bsp.BSPFile) []assetRef {
+	var refs []assetRef
+	seen := map[string]bool{}
+	add := func(paths ...string) {
+		if seen[paths[0]] {
+			return
+		}
+		seen[paths[0]] = true
+		refs = append(refs, assetRef{paths: paths})
+	}
+	for _, t := range textureNames(bspfile) {
+		add(texturePaths(t)...)
+	}
+	for _, ent := range bspfile.Ents {
+		if ent.Class == "worldspawn" && ent.Values["sky"] != "" {
+			for _, side := range skySides {
+				base := path.Join("env", ent.Values["sky"]+side)
+				add(base+".tga", base+".pcx")
+			}
+		}
+		if noise := ent.Values["noise"]; noise != "" {
+			if path.Ext(noise) == "" {
+				noise += ".wav"
+			}
+			add(path.Join("sound", noise))
+		}
+		// "*N" models are brush models inside the bsp itself
+		if model := ent.Values["model"]; model != "" && !strings.HasPrefix(model, "*") {
+			add(model)
+		}
+	}
+	return refs
+}
+
+// missingAssets returns the assets a map needs that aren't in the repo, or
+// in the set of files provided alongside it (the rest of an uploaded
+// archive, lowercased). Each missing asset is reported by its first path.
+func missingAssets(bspfile *bsp.BSPFile, provided map[string]bool) []string {
+	var missing []string
+	for _, ref := range mapAssets(bspfile) {
+		found := false
+		for _, p := range ref.paths {
+			// provided is lowercase, the game doesn't care about case
+			if provided[strings.ToLower(p)] || inRepo(p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, ref.paths[0])
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// texturePaths is everywhere a wall texture (ex: "e1u1/floor1_3") could be.
+func texturePaths(name string) []string {
+	var paths []string
+	for _, ext := range textureExts {
+		paths = append(paths, path.Join("textures", name+ext))
+	}
+	return paths
+}
+
+// inRepo is true if there's a file at p (relative to the repo), in any case.
+func inRepo(p string) bool {
+	name, found := findRepoFile(p)
+	return found && fileExists(path.Join(config.GetRepoPath(), name))
+}
+
+// archiveInspection is what we found looking at the maps in an archive.
+type archiveInspection struct {
+	missing  []string          // assets not in the repo or the archive
+	reports  string            // gameplay report for each map
+	previews []*discordgo.File // overhead image of each map
+}
+
+// inspectArchiveMaps will check every map in an archive for assets that
+// aren't in the repo or elsewhere in the archive, and build a report
+// (size, entities, gameplay) and preview image for each.
+func inspectArchiveMaps(archive AssetArchive) (*archiveInspection, error) {
+	insp := &archiveInspection{}
+	entries := archive.Entries()
+	provided := map[string]bool{}
+	for _, e := range entries {
+		provided[strings.ToLower(e.Name)] = true
+	}
+	for _, e := range entries {
+		f := e.Name
+		if !strings.HasPrefix(f, "maps/") || !strings.HasSuffix(strings.ToLower(f), ".bsp") {
+			continue
+		}
+		err := withEntryBSP(archive, e, func(bspfile *bsp.BSPFile) {
+			for _, a := range missingAssets(bspfile, provided) {
+				insp.missing = append(insp.missing, fmt.Sprintf("%s (%s)", a, path.Base(f)))
+			}
+			insp.reports += fmt.Sprintf("`%s`\n```  %d bytes\n  %d entities\n  %d textures\n%s```", path.Base(f), e.Size, len(bspfile.Ents), len(bspfile.FetchTextures()), analyzeEntities(bspfile.Ents))
+			if preview := mapPreviewFile(bspfile, path.Base(f)); preview != nil {
+				insp.previews = append(insp.previews, preview)
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", f, err)
+		}
+	}
+	return insp, nil
+}
+
+// withEntryBSP parses a map in an archive and hands it to fn. A map that's
+// already on disk is used in place, otherwise it's read out of the archive.
+func withEntryBSP(archive AssetArchive, e ArchiveEntry, fn func(*bsp.BSPFile)) error {
+	if e.Path != "" {
+		bspfile, err := bsp.OpenBSPFile(e.Path)
+		if err != nil {
+			return err
+		}
+		defer bspfile.Close()
+		fn(bspfile)
+		return nil
+	}
+	fp, err := archive.Open(e.Name)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	data, err := io.ReadAll(limitReader(fp, maxFileBytes(), e.Name))
+	if err != nil {
+		return err
+	}
+	return withBSPData(data, fn)
+}
+
+// withBSPData will parse a map that's not on disk and hand it to fn. The bsp
+// library only reads files, so it's written to temp space first.
+func withBSPData(data []byte, fn func(*bsp.BSPFile)) error {
+	tmp := path.Join(config.TempPath, uuid.New().String()+".bsp")
+	err := os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	bspfile, err := bsp.OpenBSPFile(tmp)
+	if err != nil {
+		return err
+	}
+	defer bspfile.Close()
+	fn(bspfile)
+	return nil
+}
+
+// checkMissingAssets applies the missing asset policy to an upload. It
+// returns false if the upload should be rejected, in which case the
+// uploader has already been told why. Otherwise any missing assets are
+// returned as warnings to include in the confirmation.
+func (f *FileUpload) checkMissingAssets(pm *discordgo.Channel, missing []string) (bool, string) {
+	if len(missing) == 0 {
+		return true, ""
+	}
+	list := fmt.Sprintf("```\n%s\n```", strings.Join(missing, "\n"))
+	if len(list) > 1800 {
+		list = list[:1790] + "\n...```"
+	}
+	if config.GetMissingAssets() == pb.MissingAssetPolicy_REJECT && !f.dryRun {
+		msg := fmt.Sprintf("`%s` was not committed, it needs %d files that aren't in the repo or your upload:\n%s", f.name, len(missing), list)
+		f.session.ChannelMessageSend(pm.ID, msg)
+		log.Printf("%q rejected, %d missing assets\n", f.name, len(missing))
+		return false, ""
+	}
+	return true, fmt.Sprintf("Warning: %d files it needs aren't in the repo:\n%s", len(missing), list)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+// Textures can be in the repo in any case, and in any of the formats
+// clients load.
+func TestTextureInRepo(t *testing.T) {
+	repo := t.TempDir()
+	old := config
+	config = &pb.BotConfig{RepoPath: repo}
+	t.Cleanup(func() { config = old })
+	writeRepoFile(t, repo, "textures/E1U1/Floor1_3.wal", "wal")
+	writeRepoFile(t, repo, "textures/custom/metal.png", "png")
+	writeRepoFile(t, repo, "textures/custom/rust.TGA", "tga")
+	if err := os.MkdirAll(filepath.Join(repo, "textures", "custom", "grate.jpg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		texture string
+		found   bool
+	}{
+		{"e1u1/floor1_3", true},
+		{"custom/metal", true},
+		{"custom/rust", true},
+		{"custom/grate", false}, // a directory isn't a texture
+		{"custom/missing", false},
+		{"e1u2/floor1_3", false},
+	}
+	for _, tc := range tests {
+		found := false
+		for _, p := range texturePaths(tc.texture) {
+			found = found || inRepo(p)
+		}
+		if found != tc.found {
+			t.Errorf("%q in repo = %v, want %v", tc.texture, found, tc.found)
+		}
+	}
+}
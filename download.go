@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+)
+
+const (
+	downloadAttempts = 3
+	downloadBackoff  = 2 * time.Second // doubled after each attempt
+)
+
+// downloadClient fetches attachments. The overall timeout is generous since
+// attachments can be big, but a connection that stalls gives up quickly.
+var downloadClient = &http.Client{
+	Timeout: 10 * time.Minute,
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// downloadAttachment saves an attachment to dest, hashing it along the way.
+// Failed downloads are retried, but going over the size limit isn't. If it
+// doesn't work out dest is removed.
+func downloadAttachment(a *discordgo.MessageAttachment, dest string) (sum [32]byte, size int64, err error) {
+	delay := downloadBackoff
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		sum, size, err = downloadOnce(a, dest)
+		if err == nil {
+			return sum, size, nil
+		}
+		os.Remove(dest)
+		if _, ok := err.(*limitError); ok {
+			return sum, size, err
+		}
+		log.Printf("download attempt %d of %d for %q failed: %v\n", attempt, downloadAttempts, a.Filename, err)
+		if attempt < downloadAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return sum, size, err
+}
+
+// downloadOnce streams an attachment to dest. The size has to match what
+// Discord says it is, anything else is a broken download.
+func downloadOnce(a *discordgo.MessageAttachment, dest string) (sum [32]byte, size int64, err error) {
+	resp, err := downloadClient.Get(a.URL)
+	if err != nil {
+		return sum, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return sum, 0, fmt.Errorf("download failed: %s", resp.Status)
+	}
+	fp, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return sum, 0, err
+	}
+	h := sha256.New()
+	size, err = io.Copy(io.MultiWriter(fp, h), limitReader(resp.Body, maxAttachmentBytes(), a.Filename))
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return sum, size, err
+	}
+	if a.Size > 0 && size != int64(a.Size) {
+		return sum, size, fmt.Errorf("got %d bytes, expected %d", size, a.Size)
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, size, nil
+}
+
+// cleanTempPath removes any of our files left in the temp directory, from
+// uploads that were in progress when the bot last stopped. They're all
+// named with a uuid, anything else is left alone in case the directory is
+// shared.
+func cleanTempPath() {
+	entries, err := os.ReadDir(config.GetTempPath())
+	if err != nil {
+		log.Println("unable to clean temp directory:", err)
+		return
+	}
+	removed := 0
+	for _, e := range entries {
+		name := e.Name()
+		if _, err := uuid.Parse(strings.TrimSuffix(name, path.Ext(name))); err != nil {
+			continue
+		}
+		err := os.RemoveAll(path.Join(config.GetTempPath(), name))
+		if err != nil {
+			log.Println("unable to clean temp directory:", err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("removed %d leftover files from %q\n", removed, config.GetTempPath())
+	}
+}
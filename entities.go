@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/packetflinger/libq2/bsp"
+)
+
+const defaultMinDMSpawns = 4
+
+// powerup item classnames
+var powerups = map[string]bool{
+	"item_quad":            true,
+	"item_invulnerability": true,
+	"item_silencer":        true,
+	"item_breather":        true,
+	"item_enviro":          true,
+	"item_adrenaline":      true,
+	"item_bandolier":       true,
+	"item_pack":            true,
+	"item_power_screen":    true,
+	"item_power_shield":    true,
+}
+
+// entityReport is a gameplay summary of a map's entity lump.
+type entityReport struct {
+	message      string // worldspawn message (the map's title)
+	dmSpawns     int
+	teamSpawns   [2]int // CTF, team1 and team2
+	flags        [2]bool
+	intermission bool
+	weapons      int
+	armor        int
+	powerups     int
+	health       int
+	ammo         int
+}
+
+// analyzeEntities counts up the spawns and items in a map.
+func analyzeEntities(ents []bsp.BSPEntity) entityReport {
+	var r entityReport
+	for _, e := range ents {
+		switch {
+		case e.Class == "worldspawn":
+			r.message = e.Values["message"]
+		case e.Class == "info_player_deathmatch":
+			r.dmSpawns++
+		case e.Class == "info_player_team1":
+			r.teamSpawns[0]++
+		case e.Class == "info_player_team2":
+			r.teamSpawns[1]++
+		case e.Class == "item_flag_team1":
+			r.flags[0] = true
+		case e.Class == "item_flag_team2":
+			r.flags[1] = true
+		case e.Class == "info_player_intermission":
+			r.intermission = true
+		case strings.HasPrefix(e.Class, "weapon_"):
+			r.weapons++
+		case strings.HasPrefix(e.Class, "item_armor"):
+			r.armor++
+		case powerups[e.Class]:
+			r.powerups++
+		case strings.HasPrefix(e.Class, "item_health"):
+			r.health++
+		case strings.HasPrefix(e.Class, "ammo_"):
+			r.ammo++
+		}
+	}
+	return r
+}
+
+// isCTF is true if the map has anything CTF specific in it.
+func (r entityReport) isCTF() bool {
+	return r.teamSpawns[0]+r.teamSpawns[1] > 0 || r.flags[0] || r.flags[1]
+}
+
+// problems lists the things about a map that will likely cause trouble on
+// a deathmatch server.
+func (r entityReport) problems() []string {
+	var out []string
+	want := int(config.GetMinDmSpawns())
+	if want <= 0 {
+		want = defaultMinDMSpawns
+	}
+	if r.dmSpawns < want {
+		out = append(out, fmt.Sprintf("only %d deathmatch spawns (at least %d recommended)", r.dmSpawns, want))
+	}
+	if !r.intermission {
+		out = append(out, "no info_player_intermission, the scoreboard camera will use a spawn point")
+	}
+	if r.isCTF() {
+		if r.teamSpawns[0] != r.teamSpawns[1] {
+			out = append(out, fmt.Sprintf("uneven CTF team spawns (%d vs %d)", r.teamSpawns[0], r.teamSpawns[1]))
+		}
+		if !r.flags[0] || !r.flags[1] {
+			out = append(out, "CTF map is missing a team flag")
+		}
+	}
+	if r.weapons == 0 {
+		out = append(out, "no weapons")
+	}
+	return out
+}
+
+// String formats the report for a Discord message.
+func (r entityReport) String() string {
+	out := ""
+	if r.message != "" {
+		out += fmt.Sprintf("  title: %s\n", r.message)
+	}
+	out += fmt.Sprintf("  %d deathmatch spawns\n", r.dmSpawns)
+	if r.isCTF() {
+		out += fmt.Sprintf("  %d/%d team spawns\n", r.teamSpawns[0], r.teamSpawns[1])
+	}
+	out += fmt.Sprintf("  %d weapons, %d armor, %d powerups, %d health, %d ammo\n", r.weapons, r.armor, r.powerups, r.health, r.ammo)
+	for _, p := range r.problems() {
+		out += "  ! " + p + "\n"
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+const forgeTimeout = 30 * time.Second
+
+// A Forge is somewhere hosting the repo that can take pull requests.
+type Forge interface {
+	// OpenPullRequest asks for head to be merged into base, and returns
+	// the URL of the new pull request.
+	OpenPullRequest(pr *pullRequest) (string, error)
+}
+
+type pullRequest struct {
+	title string
+	body  string
+	head  string // branch with the changes
+	base  string // branch to merge into
+}
+
+// newForge returns the forge described in the config.
+func newForge(cfg *pb.PullRequests) (Forge, error) {
+	if cfg.GetRepo() == "" {
+		return nil, fmt.Errorf("no repo set for pull requests")
+	}
+	client := &http.Client{Timeout: forgeTimeout}
+	apiURL := strings.TrimSuffix(cfg.GetApiUrl(), "/")
+	switch cfg.GetForge() {
+	case pb.Forge_GITHUB:
+		if apiURL == "" {
+			apiURL = "https://api.github.com"
+		}
+		return &githubForge{client: client, apiURL: apiURL, token: cfg.GetToken(), repo: cfg.GetRepo()}, nil
+	case pb.Forge_GITEA:
+		if apiURL == "" {
+			return nil, fmt.Errorf("gitea needs an api_url")
+		}
+		return &giteaForge{client: client, apiURL: apiURL, token: cfg.GetToken(), repo: cfg.GetRepo()}, nil
+	case pb.Forge_GITLAB:
+		if apiURL == "" {
+			apiURL = "https://gitlab.com/api/v4"
+		}
+		return &gitlabForge{client: client, apiURL: apiURL, token: cfg.GetToken(), project: cfg.GetRepo()}, nil
+	}
+	return nil, fmt.Errorf("unknown forge %v", cfg.GetForge())
+}
+
+// githubForge opens pull requests with the GitHub REST API.
+type githubForge struct {
+	client *http.Client
+	apiURL string
+	token  string
+	repo   string // owner/name
+}
+
+func (g *githubForge) OpenPullRequest(pr *pullRequest) (string, error) {
+	req := map[string]string{"title": pr.title, "body": pr.body, "head": pr.head, "base": pr.base}
+	headers := map[string]string{
+		"Authorization": "Bearer " + g.token,
+		"Accept":        "application/vnd.github+json",
+	}
+	var resp struct {
+		HTMLURL string `json:"html_url"`
+	}
+	err := postJSON(g.client, g.apiURL+"/repos/"+g.repo+"/pulls", headers, req, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.HTMLURL, nil
+}
+
+// giteaForge opens pull requests with the Gitea (or Forgejo) API, which is
+// nearly the same as GitHub's.
+type giteaForge struct {
+	client *http.Client
+	apiURL string // https://host/api/v1
+	token  string
+	repo   string // owner/name
+}
+
+func (g *giteaForge) OpenPullRequest(pr *pullRequest) (string, error) {
+	req := map[string]string{"title": pr.title, "body": pr.body, "head": pr.head, "base": pr.base}
+	headers := map[string]string{"Authorization": "token " + g.token}
+	var resp struct {
+		HTMLURL string `json:"html_url"`
+	}
+	err := postJSON(g.client, g.apiURL+"/repos/"+g.repo+"/pulls", headers, req, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.HTMLURL, nil
+}
+
+// gitlabForge opens merge requests with the GitLab API.
+type gitlabForge struct {
+	client  *http.Client
+	apiURL  string
+	token   string
+	project string // namespace/name or numeric ID
+}
+
+func (g *gitlabForge) OpenPullRequest(pr *pullRequest) (string, error) {
+	req := map[string]string{
+		"title":         pr.title,
+		"description":   pr.body,
+		"source_branch": pr.head,
+		"target_branch": pr.base,
+	}
+	headers := map[string]string{"PRIVATE-TOKEN": g.token}
+	var resp struct {
+		WebURL string `json:"web_url"`
+	}
+	endpoint := g.apiURL + "/projects/" + url.PathEscape(g.project) + "/merge_requests"
+	err := postJSON(g.client, endpoint, headers, req, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.WebURL, nil
+}
+
+// postJSON sends body as JSON and decodes the JSON response into out.
+// Anything other than a 2xx response is an error.
+func postJSON(client *http.Client, endpoint string, headers map[string]string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s: %s", endpoint, resp.Status, strings.TrimSpace(string(respData)))
+	}
+	err = json.Unmarshal(respData, out)
+	if err != nil {
+		return fmt.Errorf("error parsing response from %s: %v", endpoint, err)
+	}
+	return nil
+}
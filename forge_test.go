@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+func TestForgeOpenPullRequest(t *testing.T) {
+	pr := &pullRequest{
+		title: "Add q2dm1.bsp",
+		body:  "Uploaded to Discord by someone.",
+		head:  "upload/someone/q2dm1",
+		base:  "main",
+	}
+	tests := []struct {
+		forge      pb.Forge
+		repo       string
+		path       string // escaped
+		authHeader string
+		auth       string
+		body       map[string]string
+		response   string
+		want       string
+	}{
+		{
+			forge:      pb.Forge_GITHUB,
+			repo:       "owner/maps",
+			path:       "/repos/owner/maps/pulls",
+			authHeader: "Authorization",
+			auth:       "Bearer secret",
+			body:       map[string]string{"title": pr.title, "body": pr.body, "head": pr.head, "base": pr.base},
+			response:   `{"number": 7, "html_url": "https://github.com/owner/maps/pull/7"}`,
+			want:       "https://github.com/owner/maps/pull/7",
+		},
+		{
+			forge:      pb.Forge_GITEA,
+			repo:       "owner/maps",
+			path:       "/repos/owner/maps/pulls",
+			authHeader: "Authorization",
+			auth:       "token secret",
+			body:       map[string]string{"title": pr.title, "body": pr.body, "head": pr.head, "base": pr.base},
+			response:   `{"number": 7, "html_url": "https://git.example.com/owner/maps/pulls/7"}`,
+			want:       "https://git.example.com/owner/maps/pulls/7",
+		},
+		{
+			forge:      pb.Forge_GITLAB,
+			repo:       "group/maps",
+			path:       "/projects/group%2Fmaps/merge_requests",
+			authHeader: "PRIVATE-TOKEN",
+			auth:       "secret",
+			body:       map[string]string{"title": pr.title, "description": pr.body, "source_branch": pr.head, "target_branch": pr.base},
+			response:   `{"iid": 7, "web_url": "https://gitlab.com/group/maps/-/merge_requests/7"}`,
+			want:       "https://gitlab.com/group/maps/-/merge_requests/7",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.forge.String(), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("method = %s, want POST", r.Method)
+				}
+				if got := r.URL.EscapedPath(); got != "/api"+tc.path {
+					t.Errorf("path = %q, want %q", got, "/api"+tc.path)
+				}
+				if got := r.Header.Get(tc.authHeader); got != tc.auth {
+					t.Errorf("%s = %q, want %q", tc.authHeader, got, tc.auth)
+				}
+				if got := r.Header.Get("Content-Type"); got != "application/json" {
+					t.Errorf("Content-Type = %q", got)
+				}
+				var body map[string]string
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("decoding request: %v", err)
+				}
+				for k, v := range tc.body {
+					if body[k] != v {
+						t.Errorf("%s = %q, want %q", k, body[k], v)
+					}
+				}
+				if len(body) != len(tc.body) {
+					t.Errorf("request = %v, want %v", body, tc.body)
+				}
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(tc.response))
+			}))
+			defer srv.Close()
+
+			forge, err := newForge(&pb.PullRequests{
+				Forge:  tc.forge,
+				ApiUrl: srv.URL + "/api/",
+				Token:  "secret",
+				Repo:   tc.repo,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := forge.OpenPullRequest(pr)
+			if err != nil {
+				t.Fatalf("OpenPullRequest() error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("OpenPullRequest() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestForgeErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "garbage") {
+			w.Write([]byte("<html>not json</html>"))
+			return
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message": "A pull request already exists"}`))
+	}))
+	defer srv.Close()
+
+	for _, f := range []pb.Forge{pb.Forge_GITHUB, pb.Forge_GITEA, pb.Forge_GITLAB} {
+		forge, err := newForge(&pb.PullRequests{Forge: f, ApiUrl: srv.URL, Repo: "owner/maps"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = forge.OpenPullRequest(&pullRequest{title: "x", head: "a", base: "b"})
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("%v: OpenPullRequest() with a 422 = %v, want the response in the error", f, err)
+		}
+
+		forge, _ = newForge(&pb.PullRequests{Forge: f, ApiUrl: srv.URL, Repo: "owner/garbage"})
+		if _, err := forge.OpenPullRequest(&pullRequest{title: "x", head: "a", base: "b"}); err == nil {
+			t.Errorf("%v: OpenPullRequest() with a response that isn't JSON didn't fail", f)
+		}
+	}
+}
+
+func TestNewForge(t *testing.T) {
+	tests := []struct {
+		desc   string
+		cfg    *pb.PullRequests
+		ok     bool
+		apiURL string
+	}{
+		{"github default", &pb.PullRequests{Forge: pb.Forge_GITHUB, Repo: "o/r"}, true, "https://api.github.com"},
+		{"github enterprise", &pb.PullRequests{Forge: pb.Forge_GITHUB, Repo: "o/r", ApiUrl: "https://ghe.example.com/api/v3/"}, true, "https://ghe.example.com/api/v3"},
+		{"gitlab default", &pb.PullRequests{Forge: pb.Forge_GITLAB, Repo: "g/r"}, true, "https://gitlab.com/api/v4"},
+		{"gitea", &pb.PullRequests{Forge: pb.Forge_GITEA, Repo: "o/r", ApiUrl: "https://git.example.com/api/v1"}, true, "https://git.example.com/api/v1"},
+		{"gitea without api_url", &pb.PullRequests{Forge: pb.Forge_GITEA, Repo: "o/r"}, false, ""},
+		{"no repo", &pb.PullRequests{Forge: pb.Forge_GITHUB}, false, ""},
+		{"unknown forge", &pb.PullRequests{Forge: pb.Forge(99), Repo: "o/r"}, false, ""},
+	}
+	for _, tc := range tests {
+		forge, err := newForge(tc.cfg)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: newForge() error = %v, want ok %v", tc.desc, err, tc.ok)
+			continue
+		}
+		var apiURL string
+		switch f := forge.(type) {
+		case *githubForge:
+			apiURL = f.apiURL
+		case *giteaForge:
+			apiURL = f.apiURL
+		case *gitlabForge:
+			apiURL = f.apiURL
+		}
+		if apiURL != tc.apiURL {
+			t.Errorf("%s: api URL = %q, want %q", tc.desc, apiURL, tc.apiURL)
+		}
+	}
+}
@@ -1,11 +1,19 @@
 // There doesn't seem to be a good way programmaticlly to interface with git.
 // The "official" way is just to issue commands to the OS.
+//
+// Every command runs with the repo as its working directory rather than
+// changing the directory of the whole process, uploads are handled
+// concurrently.
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"os"
 	"os/exec"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Git struct {
@@ -19,56 +27,208 @@ func NewGit(path string) Git {
 	return Git{RepoPath: path}
 }
 
-func (g Git) add() error {
-	cwd, err := os.Getwd()
+// run a git command in the repo and return its output. Errors include
+// whatever git had to say on stderr.
+func (g Git) run(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.RepoPath
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
 	if err != nil {
-		return fmt.Errorf("getwd() error: %v", err)
-	}
-	if cwd != g.RepoPath {
-		err := os.Chdir(g.RepoPath)
-		if err != nil {
-			return fmt.Errorf("unable to change to repo path %q: %v", g.RepoPath, err)
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
 		}
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
 	}
-	addCmd := exec.Command("git", "add", g.RepoPath)
-	if err := addCmd.Run(); err != nil {
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// add stages the changes to files (relative to the repo), including
+// removing them. Nothing else in the working tree is touched, so a job can't
+// pick up files another left behind.
+func (g Git) add(files ...string) error {
+	_, err := g.run(append([]string{"add", "--all", "--"}, files...)...)
+	if err != nil {
 		return fmt.Errorf("error adding files: %v", err)
 	}
 	return nil
 }
 
-func (g Git) commit(msg string) error {
-	cwd, err := os.Getwd()
+// restore puts files back the way they are in HEAD, unstaged, undoing
+// whatever was written or deleted. Files HEAD doesn't have are removed.
+func (g Git) restore(files ...string) error {
+	_, err := g.run(append([]string{"reset", "-q", "--"}, files...)...)
 	if err != nil {
-		return fmt.Errorf("getwd() error: %v", err)
+		return fmt.Errorf("error unstaging files: %v", err)
 	}
-	if cwd != g.RepoPath {
-		err := os.Chdir(g.RepoPath)
+	for _, f := range files {
+		if _, err := g.run("cat-file", "-e", "HEAD:"+f); err != nil {
+			_, err = g.run("clean", "-f", "-q", "--", f)
+		} else {
+			_, err = g.run("checkout", "HEAD", "--", f)
+		}
 		if err != nil {
-			return fmt.Errorf("unable to change to repo path %q: %v", g.RepoPath, err)
+			return fmt.Errorf("error restoring %q: %v", f, err)
 		}
 	}
-	commitCmd := exec.Command("git", "commit", "-m", msg)
-	if err := commitCmd.Run(); err != nil {
-		return fmt.Errorf("error committing changes: %v", err)
-	}
 	return nil
 }
 
+// commit the staged changes and return the new commit's hash. author is
+// "Name <email>", if it's empty git's configured identity is used.
+func (g Git) commit(msg, author string) (string, error) {
+	args := []string{"commit", "-m", msg}
+	if author != "" {
+		args = append(args, "--author", author)
+	}
+	_, err := g.run(args...)
+	if err != nil {
+		return "", fmt.Errorf("error committing changes: %v", err)
+	}
+	return g.head()
+}
+
 func (g Git) Push() error {
-	cwd, err := os.Getwd()
+	_, err := g.run("push")
 	if err != nil {
-		return fmt.Errorf("getwd() error: %v", err)
+		return fmt.Errorf("error pushing changes: %v", err)
 	}
-	if cwd != g.RepoPath {
-		err := os.Chdir(g.RepoPath)
-		if err != nil {
-			return fmt.Errorf("unable to change to repo path %q: %v", g.RepoPath, err)
-		}
+	return nil
+}
+
+// head returns the hash of the currently checked out commit.
+func (g Git) head() (string, error) {
+	out, err := g.run("rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("error getting HEAD commit: %v", err)
 	}
-	pushCmd := exec.Command("git", "push")
-	if err := pushCmd.Run(); err != nil {
-		return fmt.Errorf("error pushing changes: %v", err)
+	return out, nil
+}
+
+// lastCommit returns the hash, author name and date of the most recent
+// commit that touched a file (relative to the repo).
+func (g Git) lastCommit(file string) (hash, author string, when time.Time, err error) {
+	out, err := g.run("log", "-1", "--format=%H%x00%an%x00%aI", "--", file)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("error reading log for %q: %v", file, err)
+	}
+	fields := strings.Split(out, "\x00")
+	if len(fields) != 3 {
+		return "", "", time.Time{}, fmt.Errorf("%q has no commits", file)
+	}
+	when, err = time.Parse(time.RFC3339, fields[2])
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("error parsing commit date %q: %v", fields[2], err)
+	}
+	return fields[0], fields[1], when, nil
+}
+
+// currentBranch returns the name of the checked out branch.
+func (g Git) currentBranch() (string, error) {
+	return g.run("rev-parse", "--abbrev-ref", "HEAD")
+}
+
+// branchExists is true if there's a local branch with the name.
+func (g Git) branchExists(name string) bool {
+	_, err := g.run("rev-parse", "--verify", "--quiet", "refs/heads/"+name)
+	return err == nil
+}
+
+// createBranch starts a new branch at the current commit and checks it out.
+// Uncommitted changes come along with it.
+func (g Git) createBranch(name string) error {
+	_, err := g.run("checkout", "-b", name)
+	return err
+}
+
+// checkout switches to an existing branch.
+func (g Git) checkout(name string) error {
+	_, err := g.run("checkout", name)
+	return err
+}
+
+// pushBranch pushes a branch to a remote.
+func (g Git) pushBranch(remote, name string) error {
+	_, err := g.run("push", remote, name)
+	return err
+}
+
+// pullRebase fetches the upstream branch and replays any local commits on
+// top of it. If that can't be done cleanly the rebase is abandoned, leaving
+// things as they were.
+func (g Git) pullRebase() error {
+	_, err := g.run("pull", "--rebase")
+	if err != nil {
+		if _, abortErr := g.run("rebase", "--abort"); abortErr == nil {
+			return fmt.Errorf("rebase onto upstream failed, aborted: %v", err)
+		}
+		return err
 	}
 	return nil
 }
+
+// unpushed returns how many local commits the upstream branch doesn't have.
+func (g Git) unpushed() (int, error) {
+	out, err := g.run("rev-list", "--count", "@{upstream}..HEAD")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(out)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected rev-list output %q", out)
+	}
+	return n, nil
+}
+
+// markPending remembers that a branch still needs to be pushed, along with
+// the description to use for its pull request once it is.
+func (g Git) markPending(branch, description string) error {
+	_, err := g.run("config", "branch."+branch+".description", description)
+	if err != nil {
+		return err
+	}
+	_, err = g.run("config", "branch."+branch+".pushPending", "true")
+	return err
+}
+
+// clearPending forgets that a branch needs to be pushed.
+func (g Git) clearPending(branch string) error {
+	_, err := g.run("config", "--unset", "branch."+branch+".pushPending")
+	return err
+}
+
+// pendingBranches returns the branches marked by markPending.
+func (g Git) pendingBranches() ([]string, error) {
+	out, err := g.run("config", "--get-regexp", `^branch\..*\.pushpending$`)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// nothing matched
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var branches []string
+	for _, line := range strings.Split(out, "\n") {
+		key, _, _ := strings.Cut(line, " ")
+		branch := strings.TrimSuffix(strings.TrimPrefix(key, "branch."), ".pushpending")
+		if branch != "" {
+			branches = append(branches, branch)
+		}
+	}
+	return branches, nil
+}
+
+// branchDescription returns the description saved for a branch, and the
+// subject of its last commit.
+func (g Git) branchDescription(branch string) (subject, description string, err error) {
+	subject, err = g.run("log", "-1", "--format=%s", "refs/heads/"+branch)
+	if err != nil {
+		return "", "", err
+	}
+	description, _ = g.run("config", "branch."+branch+".description")
+	return subject, description, nil
+}
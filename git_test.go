@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRemote sets up a bare repo with one commit on main, to clone from.
+// Git's global config is ignored so the tests run the same anywhere.
+func testRemote(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	dir := t.TempDir()
+	seed := filepath.Join(dir, "seed")
+	remote := filepath.Join(dir, "remote.git")
+	mustGit(t, dir, "init", "-q", "-b", "main", seed)
+	configTestRepo(t, seed)
+	writeRepoFile(t, seed, "maps/q2dm1.bsp", "the edge")
+	mustGit(t, seed, "add", "--all")
+	mustGit(t, seed, "commit", "-q", "-m", "first")
+	mustGit(t, dir, "clone", "-q", "--bare", seed, remote)
+	return remote
+}
+
+// testClone clones remote into a new directory.
+func testClone(t *testing.T, remote string) Git {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "repo")
+	mustGit(t, ".", "clone", "-q", remote, dir)
+	configTestRepo(t, dir)
+	return NewGit(dir)
+}
+
+func configTestRepo(t *testing.T, dir string) {
+	t.Helper()
+	mustGit(t, dir, "config", "user.name", "Bot")
+	mustGit(t, dir, "config", "user.email", "bot@example.com")
+}
+
+func mustGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := NewGit(dir).run(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func writeRepoFile(t *testing.T, dir, name, data string) {
+	t.Helper()
+	full := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGitCommitAndPush(t *testing.T) {
+	remote := testRemote(t)
+	git := testClone(t, remote)
+
+	writeRepoFile(t, git.RepoPath, "maps/q2dm2.bsp", "tokay's towers")
+	writeRepoFile(t, git.RepoPath, "maps/leftover.bsp", "not part of this")
+	if err := git.add("maps/q2dm2.bsp"); err != nil {
+		t.Fatal(err)
+	}
+	if staged := mustGit(t, git.RepoPath, "diff", "--cached", "--name-only"); staged != "maps/q2dm2.bsp" {
+		t.Errorf("staged %q, want only maps/q2dm2.bsp", staged)
+	}
+
+	commit, err := git.commit("add q2dm2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := git.head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit != head || len(commit) != 40 {
+		t.Errorf("commit() = %q, head() = %q", commit, head)
+	}
+	if author := mustGit(t, git.RepoPath, "log", "-1", "--format=%an <%ae>"); author != "Bot <bot@example.com>" {
+		t.Errorf("default author = %q", author)
+	}
+
+	if n, err := git.unpushed(); err != nil || n != 1 {
+		t.Errorf("unpushed() = %d, %v, want 1", n, err)
+	}
+	if err := git.Push(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := git.unpushed(); err != nil || n != 0 {
+		t.Errorf("unpushed() after Push() = %d, %v, want 0", n, err)
+	}
+	if got := mustGit(t, remote, "rev-parse", "main"); got != commit {
+		t.Errorf("remote main = %q, want %q", got, commit)
+	}
+}
+
+func TestGitCommitAuthor(t *testing.T) {
+	git := testClone(t, testRemote(t))
+	writeRepoFile(t, git.RepoPath, "maps/q2dm3.bsp", "the frag pipe")
+	if err := git.add("maps/q2dm3.bsp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git.commit("add q2dm3", "someone <123@users.example.com>"); err != nil {
+		t.Fatal(err)
+	}
+	if author := mustGit(t, git.RepoPath, "log", "-1", "--format=%an <%ae>"); author != "someone <123@users.example.com>" {
+		t.Errorf("author = %q", author)
+	}
+	// the bot is still the committer
+	if committer := mustGit(t, git.RepoPath, "log", "-1", "--format=%cn"); committer != "Bot" {
+		t.Errorf("committer = %q", committer)
+	}
+	hash, author, _, err := git.lastCommit("maps/q2dm3.bsp")
+	if err != nil || author != "someone" || hash == "" {
+		t.Errorf("lastCommit() = %q, %q, %v", hash, author, err)
+	}
+}
+
+func TestGitPullRebase(t *testing.T) {
+	remote := testRemote(t)
+	ours := testClone(t, remote)
+	theirs := testClone(t, remote)
+
+	writeRepoFile(t, theirs.RepoPath, "maps/q2dm4.bsp", "from someone else")
+	if err := theirs.add("maps/q2dm4.bsp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := theirs.commit("theirs", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := theirs.Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeRepoFile(t, ours.RepoPath, "maps/q2dm5.bsp", "from us")
+	if err := ours.add("maps/q2dm5.bsp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ours.commit("ours", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ours.Push(); err == nil {
+		t.Fatal("Push() behind the remote didn't fail")
+	}
+	if err := ours.pullRebase(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ours.unpushed(); err != nil || n != 1 {
+		t.Errorf("unpushed() after pullRebase() = %d, %v, want 1", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(ours.RepoPath, "maps", "q2dm4.bsp")); err != nil {
+		t.Errorf("upstream commit missing after pullRebase(): %v", err)
+	}
+	if err := ours.Push(); err != nil {
+		t.Errorf("Push() after pullRebase() error: %v", err)
+	}
+}
+
+func TestGitPullRebaseConflict(t *testing.T) {
+	remote := testRemote(t)
+	ours := testClone(t, remote)
+	theirs := testClone(t, remote)
+
+	writeRepoFile(t, theirs.RepoPath, "maps/q2dm1.bsp", "their version")
+	if err := theirs.add("maps/q2dm1.bsp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := theirs.commit("theirs", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := theirs.Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeRepoFile(t, ours.RepoPath, "maps/q2dm1.bsp", "our version")
+	if err := ours.add("maps/q2dm1.bsp"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := ours.commit("ours", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ours.pullRebase()
+	if err == nil || !strings.Contains(err.Error(), "aborted") {
+		t.Fatalf("pullRebase() with a conflict = %v, want it aborted", err)
+	}
+	if after, _ := ours.head(); after != before {
+		t.Errorf("HEAD after aborted rebase = %q, want %q", after, before)
+	}
+	if branch, _ := ours.currentBranch(); branch != "main" {
+		t.Errorf("branch after aborted rebase = %q, want main", branch)
+	}
+	data, _ := os.ReadFile(filepath.Join(ours.RepoPath, "maps", "q2dm1.bsp"))
+	if string(data) != "our version" {
+		t.Errorf("file after aborted rebase = %q", data)
+	}
+}
+
+func TestGitErrors(t *testing.T) {
+	git := testClone(t, testRemote(t))
+	err := git.checkout("no-such-branch")
+	if err == nil {
+		t.Fatal("checkout() of a missing branch didn't fail")
+	}
+	// what git printed is part of the error
+	if !strings.Contains(err.Error(), "no-such-branch") {
+		t.Errorf("error %q doesn't include git's output", err)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("error %q doesn't wrap the exit status", err)
+	}
+
+	// a repo without a remote has nothing to push to
+	local := NewGit(t.TempDir())
+	mustGit(t, local.RepoPath, "init", "-q")
+	if err := local.Push(); err == nil || !strings.Contains(err.Error(), "fatal:") {
+		t.Errorf("Push() without a remote = %v", err)
+	}
+}
+
+func TestGitRestore(t *testing.T) {
+	git := testClone(t, testRemote(t))
+	writeRepoFile(t, git.RepoPath, "maps/q2dm1.bsp", "changed")
+	writeRepoFile(t, git.RepoPath, "maps/new.bsp", "added")
+	writeRepoFile(t, git.RepoPath, "maps/other.bsp", "someone else's")
+	if err := git.add("maps/q2dm1.bsp", "maps/new.bsp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.restore("maps/q2dm1.bsp", "maps/new.bsp"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(git.RepoPath, "maps", "q2dm1.bsp"))
+	if string(data) != "the edge" {
+		t.Errorf("restored file = %q, want the committed version", data)
+	}
+	if _, err := os.Stat(filepath.Join(git.RepoPath, "maps", "new.bsp")); !os.IsNotExist(err) {
+		t.Errorf("file added by the upload wasn't removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(git.RepoPath, "maps", "other.bsp")); err != nil {
+		t.Errorf("unrelated file was touched: %v", err)
+	}
+	if status := mustGit(t, git.RepoPath, "status", "--porcelain"); status != "?? maps/other.bsp" {
+		t.Errorf("status after restore() = %q", status)
+	}
+}
+
+func TestGitPendingBranches(t *testing.T) {
+	git := testClone(t, testRemote(t))
+	if branches, err := git.pendingBranches(); err != nil || len(branches) != 0 {
+		t.Fatalf("pendingBranches() = %q, %v, want none", branches, err)
+	}
+	if err := git.createBranch("upload/someone/q2dm1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.checkout("main"); err != nil {
+		t.Fatal(err)
+	}
+	if !git.branchExists("upload/someone/q2dm1") || git.branchExists("upload/someone/q2dm2") {
+		t.Error("branchExists() wrong")
+	}
+	if err := git.markPending("upload/someone/q2dm1", "Uploaded by someone."); err != nil {
+		t.Fatal(err)
+	}
+	branches, err := git.pendingBranches()
+	if err != nil || strings.Join(branches, ",") != "upload/someone/q2dm1" {
+		t.Errorf("pendingBranches() = %q, %v", branches, err)
+	}
+	subject, description, err := git.branchDescription("upload/someone/q2dm1")
+	if err != nil || subject != "first" || description != "Uploaded by someone." {
+		t.Errorf("branchDescription() = %q, %q, %v", subject, description, err)
+	}
+	if err := git.clearPending("upload/someone/q2dm1"); err != nil {
+		t.Fatal(err)
+	}
+	if branches, err := git.pendingBranches(); err != nil || len(branches) != 0 {
+		t.Errorf("pendingBranches() after clearPending() = %q, %v", branches, err)
+	}
+}
@@ -1,15 +1,31 @@
 module github.com/packetflinger/discordbot
 
-go 1.21
+go 1.22
 
 toolchain go1.22.3
 
 require (
-	github.com/bwmarrin/discordgo v0.25.0 // indirect
-	github.com/google/uuid v1.6.0 // indirect
+	github.com/bodgit/sevenzip v1.5.2
+	github.com/bwmarrin/discordgo v0.25.0
+	github.com/google/uuid v1.6.0
+	github.com/packetflinger/libq2 v1.0.242
+	go.etcd.io/bbolt v1.3.11
+	google.golang.org/protobuf v1.36.2
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/bodgit/plumbing v1.3.0 // indirect
+	github.com/bodgit/windows v1.0.1 // indirect
 	github.com/gorilla/websocket v1.4.2 // indirect
-	github.com/packetflinger/libq2 v1.0.242 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/ulikunitz/xz v0.5.12 // indirect
+	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
 	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b // indirect
-	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68 // indirect
-	google.golang.org/protobuf v1.36.2 // indirect
+	golang.org/x/sys v0.4.0 // indirect
+	golang.org/x/text v0.17.0 // indirect
 )
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+const (
+	defaultHistoryCount = 5
+	maxHistoryCount     = 25
+	// what fits in a Discord message (2000 characters), with room to say
+	// how many didn't
+	maxHistoryLength = 1950
+)
+
+// cmdMapsRecent will list the most recent uploads. An optional argument
+// says how many.
+func cmdMapsRecent(r *commandRequest) {
+	count := defaultHistoryCount
+	if len(r.args) > 0 {
+		n, err := strconv.Atoi(r.args[0])
+		if err != nil || n < 1 {
+			r.reply("Usage: `!maps recent [count]`")
+			return
+		}
+		count = min(n, maxHistoryCount)
+	}
+	uploads, err := store.Uploads(count, "")
+	if err != nil {
+		log.Println("error reading upload history:", err)
+		r.reply("Sorry, I couldn't read the upload history")
+		return
+	}
+	if len(uploads) == 0 {
+		r.reply("Nothing has been uploaded yet")
+		return
+	}
+	r.reply(formatUploads(uploads))
+}
+
+// cmdMapsBy will list the most recent uploads from a particular user.
+func cmdMapsBy(r *commandRequest) {
+	if len(r.args) == 0 {
+		r.reply("Usage: `!maps by @user`")
+		return
+	}
+	userID := mentionUserID(r.args[0])
+	uploads, err := store.Uploads(maxHistoryCount, userID)
+	if err != nil {
+		log.Println("error reading upload history:", err)
+		r.reply("Sorry, I couldn't read the upload history")
+		return
+	}
+	if len(uploads) == 0 {
+		r.reply(fmt.Sprintf("<@%s> hasn't uploaded anything", userID))
+		return
+	}
+	r.reply(formatUploads(uploads))
+}
+
+// mentionUserID will pull the user ID out of a mention ("<@123>" or
+// "<@!123>"). Anything else is assumed to already be an ID.
+func mentionUserID(s string) string {
+	s = strings.TrimPrefix(s, "<@")
+	s = strings.TrimPrefix(s, "!")
+	return strings.TrimSuffix(s, ">")
+}
+
+// formatUploads builds a listing of upload history records, one per line.
+// Records that won't fit in a message are left off.
+func formatUploads(uploads []*pb.UploadRecord) string {
+	var lines []string
+	length := 0
+	for i, u := range uploads {
+		commit := u.GetCommit()
+		if len(commit) > 8 {
+			commit = commit[:8]
+		}
+		line := fmt.Sprintf(
+			"<t:%d:d> `%s` by %s, %d files, %d bytes (`%s`)",
+			u.GetTimestamp(),
+			u.GetFilename(),
+			u.GetUsername(),
+			len(u.GetFiles()),
+			u.GetBytes(),
+			commit,
+		)
+		if length+len(line)+1 > maxHistoryLength {
+			lines = append(lines, fmt.Sprintf("... and %d more", len(uploads)-i))
+			break
+		}
+		lines = append(lines, line)
+		length += len(line) + 1
+	}
+	return truncateMessage(strings.Join(lines, "\n"), 2000)
+}
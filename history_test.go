@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+func TestFormatUploadsLength(t *testing.T) {
+	var uploads []*pb.UploadRecord
+	for i := 0; i < maxHistoryCount; i++ {
+		uploads = append(uploads, &pb.UploadRecord{
+			Timestamp: 1700000000,
+			Filename:  fmt.Sprintf("some_quite_long_map_pack_name_v%d_final_fixed.zip", i),
+			Username:  "someone_with_a_long_name",
+			Files:     []string{"maps/a.bsp", "maps/b.bsp"},
+			Bytes:     123456789,
+			Commit:    "0123456789abcdef0123456789abcdef01234567",
+		})
+	}
+	got := formatUploads(uploads)
+	if len(got) > 2000 {
+		t.Errorf("formatUploads() is %d long", len(got))
+	}
+	if !strings.Contains(got, uploads[0].GetFilename()) {
+		t.Errorf("formatUploads() is missing the most recent upload")
+	}
+	lines := strings.Split(got, "\n")
+	if last := lines[len(lines)-1]; last != fmt.Sprintf("... and %d more", maxHistoryCount-len(lines)+1) {
+		t.Errorf("last line = %q, want how many were left off", last)
+	}
+
+	if got := formatUploads(uploads[:2]); strings.Count(got, "\n") != 1 {
+		t.Errorf("formatUploads() of two = %q", got)
+	}
+}
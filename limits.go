@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// default limits, see the Limits message in the config
+const (
+	defaultMaxAttachmentBytes   = 100 << 20
+	defaultMaxUncompressedBytes = 512 << 20
+	defaultMaxEntries           = 5000
+	defaultMaxCompressionRatio  = 100
+	defaultMaxFileBytes         = 256 << 20
+)
+
+func maxAttachmentBytes() int64 {
+	if v := config.GetLimits().GetMaxAttachmentBytes(); v > 0 {
+		return v
+	}
+	return defaultMaxAttachmentBytes
+}
+
+func maxUncompressedBytes() int64 {
+	if v := config.GetLimits().GetMaxUncompressedBytes(); v > 0 {
+		return v
+	}
+	return defaultMaxUncompressedBytes
+}
+
+func maxEntries() int {
+	if v := config.GetLimits().GetMaxEntries(); v > 0 {
+		return int(v)
+	}
+	return defaultMaxEntries
+}
+
+func maxCompressionRatio() int64 {
+	if v := config.GetLimits().GetMaxCompressionRatio(); v > 0 {
+		return int64(v)
+	}
+	return defaultMaxCompressionRatio
+}
+
+func maxFileBytes() int64 {
+	if v := config.GetLimits().GetMaxFileBytes(); v > 0 {
+		return v
+	}
+	return defaultMaxFileBytes
+}
+
+// limitError is an upload going over one of the limits. The message is meant
+// for the uploader.
+type limitError struct {
+	msg string
+}
+
+func (e *limitError) Error() string {
+	return e.msg
+}
+
+func newLimitError(format string, args ...any) error {
+	return &limitError{msg: fmt.Sprintf(format, args...)}
+}
+
+// entrySize is the size of a file in an archive, before and after
+// decompression.
+type entrySize struct {
+	name       string
+	size       int64
+	compressed int64
+}
+
+// checkArchiveLimits checks what an archive says it contains against the
+// limits, before anything is extracted. Archives can lie about sizes, so
+// each read should also go through limitReader, and archives are opened as a
+// limitedArchive.
+func checkArchiveLimits(entries []entrySize) error {
+	if len(entries) > maxEntries() {
+		return newLimitError("it has %d files, the most allowed is %d", len(entries), maxEntries())
+	}
+	var total int64
+	for _, e := range entries {
+		if e.size > maxFileBytes() {
+			return newLimitError("`%s` is %s, the most allowed for one file is %s", e.name, formatSize(e.size), formatSize(maxFileBytes()))
+		}
+		if e.size > 0 && (e.compressed <= 0 || e.size/e.compressed > maxCompressionRatio()) {
+			return newLimitError("`%s` is compressed more than %d to 1, which looks like a zip bomb", e.name, maxCompressionRatio())
+		}
+		total += e.size
+		if total > maxUncompressedBytes() {
+			return newLimitError("it's more than %s uncompressed, the most allowed is %s", formatSize(total), formatSize(maxUncompressedBytes()))
+		}
+	}
+	return nil
+}
+
+// limitReader reads from r, failing with a limitError once more than max
+// bytes have been read.
+func limitReader(r io.Reader, max int64, name string) io.Reader {
+	return &limitedReader{r: r, remaining: max, max: max, name: name}
+}
+
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	max       int64
+	name      string
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, newLimitError("`%s` is bigger than %s", l.name, formatSize(l.max))
+	}
+	// read one byte more than allowed so going over can be noticed
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, newLimitError("`%s` is bigger than %s", l.name, formatSize(l.max))
+	}
+	return n, err
+}
+
+// declaredSize is a size an archive says something is, as an int64. Anything
+// too big to fit, or to be allowed, is just over the limit.
+func declaredSize(n uint64) int64 {
+	if n > uint64(maxUncompressedBytes()) {
+		return maxUncompressedBytes() + 1
+	}
+	return int64(n)
+}
+
+// limitedArchive counts everything read from an archive towards
+// maxUncompressedBytes, since the sizes checkArchiveLimits goes by can be
+// lies. Reading an entry more than once (hashing it, then writing it) only
+// counts it once.
+type limitedArchive struct {
+	AssetArchive
+	mu    sync.Mutex
+	read  map[string]int64 // the most read from each entry
+	total int64
+}
+
+func limitArchive(a AssetArchive) *limitedArchive {
+	return &limitedArchive{AssetArchive: a, read: map[string]int64{}}
+}
+
+func (a *limitedArchive) Open(name string) (io.ReadCloser, error) {
+	rc, err := a.AssetArchive.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &countedReader{ReadCloser: rc, archive: a, name: name}, nil
+}
+
+// count records that pos bytes of an entry have been read, failing once the
+// archive as a whole has gone over the limit.
+func (a *limitedArchive) count(name string, pos int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if pos > a.read[name] {
+		a.total += pos - a.read[name]
+		a.read[name] = pos
+	}
+	if a.total > maxUncompressedBytes() {
+		return newLimitError("it's more than %s uncompressed, the most allowed is %s", formatSize(a.total), formatSize(maxUncompressedBytes()))
+	}
+	return nil
+}
+
+type countedReader struct {
+	io.ReadCloser
+	archive *limitedArchive
+	name    string
+	pos     int64
+}
+
+func (r *countedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.pos += int64(n)
+	if lerr := r.archive.count(r.name, r.pos); lerr != nil {
+		return n, lerr
+	}
+	return n, err
+}
+
+// rejectLimit tells the uploader which limit their upload went over.
+func (f *FileUpload) rejectLimit(pm *discordgo.Channel, err error) {
+	f.session.ChannelMessageSend(pm.ID, fmt.Sprintf("`%s` was rejected because it's too big: %v", f.name, err))
+	log.Printf("%q rejected: %v\n", f.name, err)
+}
+
+// formatSize makes a byte count readable.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+// withLimits sets the limits in the config for the length of a test.
+func withLimits(t *testing.T, limits *pb.Limits) {
+	t.Helper()
+	old := config
+	config = &pb.BotConfig{Limits: limits}
+	t.Cleanup(func() { config = old })
+}
+
+// A zip can declare sizes too big for an int64, they mustn't come out
+// negative and slip past the limits.
+func TestZipDeclaredSizeOverflow(t *testing.T) {
+	withLimits(t, nil)
+	filename := filepath.Join(t.TempDir(), "upload.zip")
+	fp, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(fp)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "maps/huge.bsp",
+		Method:             zip.Store,
+		CompressedSize64:   4,
+		UncompressedSize64: 1 << 63,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("huge"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fp.Close()
+
+	archive, err := openAssetArchive(".zip", filename, "upload.zip", [32]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	var sizes []entrySize
+	for _, e := range archive.Entries() {
+		if e.Size < 0 || e.Compressed < 0 {
+			t.Errorf("%q size = %d, compressed %d", e.Name, e.Size, e.Compressed)
+		}
+		sizes = append(sizes, entrySize{name: e.Name, size: e.Size, compressed: e.Compressed})
+	}
+	var limitErr *limitError
+	if err := checkArchiveLimits(sizes); !errors.As(err, &limitErr) {
+		t.Errorf("checkArchiveLimits() = %v, want a limit error", err)
+	}
+}
+
+// The total uncompressed size is enforced on what's actually read, across
+// every file in the archive.
+func TestLimitedArchiveTotal(t *testing.T) {
+	withLimits(t, &pb.Limits{MaxUncompressedBytes: 100})
+	filename := filepath.Join(t.TempDir(), "upload.zip")
+	writeTestZip(t, filename, []testFile{
+		{name: "maps/a.bsp", data: strings.Repeat("a", 40)},
+		{name: "maps/b.bsp", data: strings.Repeat("b", 40)},
+		{name: "maps/c.bsp", data: strings.Repeat("c", 40)},
+	})
+	archive, err := openAssetArchive(".zip", filename, "upload.zip", [32]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	read := func(name string) error {
+		fp, err := archive.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fp.Close()
+		_, err = io.Copy(io.Discard, fp)
+		return err
+	}
+	for _, name := range []string{"maps/a.bsp", "maps/b.bsp", "maps/a.bsp", "maps/b.bsp"} {
+		if err := read(name); err != nil {
+			t.Fatalf("reading %q: %v, reading a file again shouldn't count twice", name, err)
+		}
+	}
+	var limitErr *limitError
+	if err := read("maps/c.bsp"); !errors.As(err, &limitErr) {
+		t.Errorf("reading past the total = %v, want a limit error", err)
+	}
+}
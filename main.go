@@ -3,9 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
@@ -15,7 +13,6 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/google/uuid"
-	"github.com/packetflinger/libq2/state"
 	"google.golang.org/protobuf/encoding/prototext"
 
 	pb "github.com/packetflinger/discordbot/proto"
@@ -25,7 +22,7 @@ var (
 	configFile = flag.String("config", "", "Protobuf config file")
 	config     *pb.BotConfig
 	err        error
-	fileTypes  = []string{".bsp", ".pak", ".pkz", ".zip"}
+	fileTypes  = []string{".bsp", ".pak", ".pkz", ".pk3", ".zip", ".7z"}
 )
 
 func main() {
@@ -52,6 +49,7 @@ func main() {
 		}
 	}
 	log.Printf("using %q for temp space", config.TempPath)
+	cleanTempPath()
 
 	if _, err := os.Stat(config.GetRepoPath()); os.IsNotExist(err) {
 		if err != nil {
@@ -59,26 +57,59 @@ func main() {
 		}
 	}
 
+	if config.DbPath == "" || config.StagingPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatalf("unable to find home directory: %v\n", err)
+		}
+		if config.DbPath == "" {
+			config.DbPath = path.Join(home, ".config", "discordbot", "bot.db")
+		}
+		if config.StagingPath == "" {
+			config.StagingPath = path.Join(home, ".config", "discordbot", "staging")
+		}
+	}
+	if prs := config.GetPullRequests(); prs != nil {
+		if _, err := newForge(prs); err != nil {
+			log.Fatalf("pull request config error: %v\n", err)
+		}
+	}
+
+	store, err = openStore(config.GetDbPath())
+	if err != nil {
+		log.Fatalf("error opening database: %v\n", err)
+	}
+	defer store.Close()
+
+	// handlers can queue repo jobs as soon as the connection is open
+	repoJobs = newRepoQueue(int(config.GetQueueSize()))
+
 	bot, err := discordgo.New("Bot " + config.GetAuthToken())
 	if err != nil {
 		log.Fatalln("error creating Discord session:", err)
 	}
 	bot.AddHandler(handleMessage)
+	bot.AddHandler(handleInteraction)
+	bot.AddHandler(handleReactionAdd)
 
-	// we only care about receiving message events.
-	bot.Identify.Intents = discordgo.IntentsGuildMessages
+	// we only care about receiving message and reaction events.
+	bot.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsGuildMessageReactions
 
 	err = bot.Open()
 	if err != nil {
 		log.Fatalln("error opening connection,", err)
 	}
 	log.Printf("Discord bot running...\n")
+	registerCommands(bot)
+	go runServerMonitor(bot)
+	go runRepoSync(bot)
 
 	// Wait here until CTRL-C or other term signal is received.
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	<-sc
 
+	unregisterCommands(bot)
 	bot.Close()
 }
 
@@ -123,38 +154,25 @@ func handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 // message containing text. Our own replies are filtered out before this is
 // called.
 func handleMessageText(s *discordgo.Session, m *discordgo.MessageCreate) {
-	if len(m.Content) < 11 {
+	if noteRejectReason(s, m) {
 		return
 	}
-	if strings.HasPrefix(m.Content, "!q2 ") && contains(m.ChannelID, config.GetStatusChannels()) {
-		arg := m.Content[4:]
-		if strings.Contains(arg, " ") {
-			return
-		}
-		go func() {
-			log.Printf("%s[%s] requesting server status: %s\n", m.Author.Username, m.Author.ID, arg)
-			srv, err := state.NewServer(arg)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			info, err := srv.FetchInfo()
-			if err != nil {
-				log.Println("serverinfo fetch fail:", err)
-				return
-			}
-			status := formatStatus(info)
-			s.ChannelMessageSend(m.ChannelID, status)
-		}()
-	}
+	dispatchText(s, m)
 }
 
 // handleMessageAttachments will inspect any file attachments to messages
 // posted in the channels, decide if it's something it should handle (maps),
 // download and do something with them.
+//
+// Uploads to a validate channel, or with a "!validate" caption, go through
+// all the same checks but nothing is written to the repo.
 func handleMessageAttachments(s *discordgo.Session, m *discordgo.MessageCreate) {
-	if contains(m.ChannelID, config.GetMapChannels()) {
+	validate := contains(m.ChannelID, config.GetValidateChannels())
+	if contains(m.ChannelID, config.GetMapChannels()) || validate {
+		dryRun := validate || strings.HasPrefix(m.Content, "!validate")
 		go func() {
+			batch := &uploadBatch{}
+			var uploads []*FileUpload
 			for _, v := range m.Attachments {
 				dl, err := url.Parse(v.URL)
 				if err != nil {
@@ -165,16 +183,15 @@ func handleMessageAttachments(s *discordgo.Session, m *discordgo.MessageCreate)
 				if extension == "" {
 					continue
 				}
-				data, err := grabFileContents(v.URL)
-				if err != nil {
-					log.Printf("error downloading %v: %v\n", v.URL, err)
-					continue
+				// anyone can check a file, only some can commit one
+				if !dryRun && !authorized(s, m.GuildID, m.Author.ID, m.Member, pb.Capability_UPLOAD) {
+					log.Printf("upload from %s[%s] refused, not allowed\n", m.Author.Username, m.Author.ID)
+					sendDM(s, m.Author.ID, denied(pb.Capability_UPLOAD))
+					return
 				}
-				name := uuid.New().String()
-				dest := path.Join(config.TempPath, name)
-				err = os.WriteFile(dest, data, 0644)
-				if err != nil {
-					log.Printf("error writing %q: %v\n", dest, err)
+				if int64(v.Size) > maxAttachmentBytes() {
+					log.Printf("%q from %s[%s] is too big (%d bytes)\n", v.Filename, m.Author.Username, m.Author.ID, v.Size)
+					sendDM(s, m.Author.ID, fmt.Sprintf("`%s` was rejected because it's too big: it's %s, the most allowed is %s", v.Filename, formatSize(int64(v.Size)), formatSize(maxAttachmentBytes())))
 					continue
 				}
 				remoteURL, err := url.Parse(v.URL)
@@ -183,23 +200,70 @@ func handleMessageAttachments(s *discordgo.Session, m *discordgo.MessageCreate)
 					continue
 				}
 				remoteFile := path.Base(remoteURL.Path)
+				name := uuid.New().String()
+				dest := path.Join(config.TempPath, name)
 				log.Printf("downloading %q to %q\n", remoteFile, dest)
-				fu := FileUpload{
+				sum, size, err := downloadAttachment(v, dest)
+				if err != nil {
+					log.Printf("error downloading %v: %v\n", v.URL, err)
+					if _, ok := err.(*limitError); ok {
+						sendDM(s, m.Author.ID, fmt.Sprintf("`%s` was rejected because it's too big: %v", v.Filename, err))
+					} else {
+						sendDM(s, m.Author.ID, fmt.Sprintf("Sorry, I couldn't download `%s`, please try again.", v.Filename))
+					}
+					continue
+				}
+				fu := &FileUpload{
 					session:   s,
 					message:   m,
 					name:      remoteFile,
 					localName: dest,
+					extension: extension,
+					sum:       sum,
+					size:      size,
+					dryRun:    dryRun,
+					batch:     batch,
+				}
+				// moderators don't need to wait for themselves
+				if config.GetReviewChannel() != "" && !dryRun && !authorized(s, m.GuildID, m.Author.ID, m.Member, pb.Capability_MODERATE) {
+					fu.stageDir = path.Join(config.GetStagingPath(), name)
+				}
+				uploads = append(uploads, fu)
+			}
+			if len(uploads) == 0 {
+				return
+			}
+
+			// dry runs don't touch the repo, no need to wait
+			if dryRun {
+				for _, fu := range uploads {
+					fu.process()
 				}
-				switch extension {
-				case ".bsp":
-					fu.processBSP(dest)
-				case ".pak":
-					fu.processPAK(dest)
-				case ".zip":
-					fu.processZIP(dest)
-				case ".pkz":
-					fu.processZIP(dest)
+				return
+			}
+			var names []string
+			for _, fu := range uploads {
+				names = append(names, "`"+fu.name+"`")
+			}
+			what := strings.Join(names, ", ")
+			ahead, ok := repoJobs.add(&repoJob{
+				description: fmt.Sprintf("%s from %s", what, m.Author.Username),
+				run: func() {
+					for _, fu := range uploads {
+						fu.process()
+					}
+					batch.commit()
+				},
+			})
+			if !ok {
+				for _, fu := range uploads {
+					os.Remove(fu.localName)
 				}
+				sendDM(s, m.Author.ID, queueFullMessage(what))
+				return
+			}
+			if msg := queuedMessage(what, ahead); msg != "" {
+				sendDM(s, m.Author.ID, msg)
 			}
 		}()
 	}
@@ -228,21 +292,6 @@ func validFileExtension(dl string, exts []string) string {
 	return out
 }
 
-// Download the file from Discords HTTPS servers. Returns the actual data.
-func grabFileContents(url string) ([]byte, error) {
-	out := []byte{}
-	r, err := http.Get(url)
-	if err != nil {
-		return out, err
-	}
-	defer r.Body.Close()
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		return out, err
-	}
-	return data, nil
-}
-
 // Helper function, if string is in slice
 //
 // Can use "all" in slice to match any
@@ -265,33 +314,3 @@ func contains(needle string, haystack []string) bool {
 	}
 	return yes
 }
-
-// Format the ServerInfo output for printing
-func formatStatus(info state.ServerInfo) string {
-	output := fmt.Sprintf(
-		"%s\n%s - %s/%s",
-		info.Server["hostname"],
-		info.Server["mapname"],
-		info.Server["player_count"],
-		info.Server["maxclients"],
-	)
-	if info.Server["gamedir"] == "opentdm" {
-		if info.Server["time_remaining"] != "WARMUP" {
-			output = fmt.Sprintf(
-				"%s\nMatch time remaining: %s\nScore: %s:%s",
-				output,
-				info.Server["time_remaining"],
-				info.Server["score_a"],
-				info.Server["score_b"],
-			)
-		}
-	}
-	if len(info.Players) > 0 {
-		var players []string
-		for _, p := range info.Players {
-			players = append(players, p.Name)
-		}
-		output += fmt.Sprintf("\n[`%s`]", strings.Join(players, ", "))
-	}
-	return output
-}
@@ -1,139 +1,378 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"path"
-	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/packetflinger/libq2/bsp"
-	"github.com/packetflinger/libq2/pak"
-	"github.com/packetflinger/libq2/proto"
+
+	pb "github.com/packetflinger/discordbot/proto"
 )
 
 type FileUpload struct {
-	name      string // the original filename uploaded (no path)
-	localName string // temp name in local filesystem
+	name      string   // the original filename uploaded (no path)
+	localName string   // temp name in local filesystem
+	extension string   // which of fileTypes it is
+	sum       [32]byte // sha256 of the file
+	size      int64
+	dryRun    bool            // check everything, but don't touch the repo
+	stageDir  string          // if set, write here and wait for a moderator
+	staged    bool            // sent for review, the stage directory is in use
+	parked    bool            // waiting for an overwrite to be confirmed, keep the files
+	overwrite map[string]bool // answers to overwrite confirmations, by repo path
+	batch     *uploadBatch
 	session   *discordgo.Session
 	message   *discordgo.MessageCreate
 }
 
-// Download the standalone .bps map file, add it to the repo in the /maps
-// directory.
-func (f *FileUpload) processBSP(mapfile string) {
-	var msg string
+// Hard-coded list of mod directories we'll take files from in archives.
+var assetDirs = []string{"maps/", "models/", "textures/", "env/", "sound/", "sounds/", "pics/", "players/"}
+
+// process checks the upload and writes it to the repo (or stages it, or
+// just reports on it). Every kind of file is opened as an AssetArchive and
+// handled the same way: names and sizes are checked, maps are inspected for
+// missing assets, then anything in a mod directory is written and added to
+// the batch (or sent for review). Anything trying to escape, too big, or
+// leaving a map without its assets is rejected.
+func (f *FileUpload) process() {
+	// a bad upload only loses itself, not the rest of its batch or the bot
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("processing %q panicked: %v\n", f.name, r)
+		}
+	}()
+	f.parked = false
+	defer func() {
+		if !f.parked {
+			f.discard()
+		}
+	}()
 	pm, err := f.session.UserChannelCreate(f.message.Author.ID)
 	if err != nil {
 		log.Println("error creating direct message channel:", err)
+		return
 	}
-	bspfile, err := bsp.OpenBSPFile(mapfile)
+	archive, err := openAssetArchive(f.extension, f.localName, f.name, f.sum)
 	if err != nil {
-		msg = fmt.Sprintf("invalid BPS file: %v\n", err)
-		log.Println(msg)
+		log.Printf("error opening %q: %v\n", f.name, err)
+		msg := fmt.Sprintf("`%s` isn't a valid %s file", f.name, strings.TrimPrefix(f.extension, "."))
 		f.session.ChannelMessageSend(pm.ID, msg)
 		return
 	}
-	data, err := os.ReadFile(f.localName)
-	if err != nil {
-		log.Printf("unable to open %q [%q], aborting\n", f.localName, f.name)
+	defer archive.Close()
+	entries := archive.Entries()
+	if problems := checkArchiveEntries(entries); len(problems) > 0 {
+		f.rejectUnsafe(pm, problems)
 		return
 	}
-	outname := path.Join(config.RepoPath, "maps", f.name)
-	err = os.WriteFile(outname, data, 0644)
-	if err != nil {
-		log.Printf("unable to write %q to %q, aborting\n", f.localName, outname)
+	var sizes []entrySize
+	for _, e := range entries {
+		sizes = append(sizes, entrySize{name: e.Name, size: e.Size, compressed: e.Compressed})
+	}
+	if err := checkArchiveLimits(sizes); err != nil {
+		f.rejectLimit(pm, err)
 		return
 	}
-	msg = fmt.Sprintf("Added %s, submitted by %s[%s]", f.name, f.message.Author.Username, f.message.Author.ID)
-	err = commitAndPush(msg)
+	insp, err := inspectArchiveMaps(archive)
 	if err != nil {
-		log.Println("git error:", err)
+		log.Printf("error checking %q for missing assets: %v\n", f.name, err)
+		f.session.ChannelMessageSend(pm.ID, fmt.Sprintf("`%s` contains an invalid map: %v", f.name, err))
 		return
 	}
-	msg = fmt.Sprintf("Added `%s`\n```  %d bytes\n  %d entities\n  %d textures\n```", f.name, len(data), len(bspfile.Ents), len(bspfile.FetchTextures()))
-	f.session.ChannelMessageSend(pm.ID, msg)
-}
-
-// If we're given a .pak file to add, it must contain the proper virtual file
-// system structure. It should contain a `/maps` folder containing any .bps
-// files, a `/textures` directory for textures, etc. Random files in the root
-// will not be committed.
-func (f *FileUpload) processPAK(filename string) {
-	pm, err := f.session.UserChannelCreate(f.message.Author.ID)
-	if err != nil {
-		log.Println("error creating direct message channel:", err)
+	if f.dryRun {
+		var valid, skipped, problems []string
+		for _, m := range insp.missing {
+			problems = append(problems, "missing "+m)
+		}
+		for _, e := range entries {
+			if e.Dir {
+				continue
+			}
+			if hasPrefix(e.Name, assetDirs) {
+				valid = append(valid, e.Name)
+			} else {
+				skipped = append(skipped, e.Name)
+			}
+		}
+		if len(valid) == 0 {
+			problems = append(problems, "no top-level folders matching a mod directory ("+strings.Join(assetDirs, ", ")+")")
+		}
+		hashes, err := hashAssets(archive, entries)
+		if err != nil {
+			f.rejectLimit(pm, err)
+			return
+		}
+		// what the overwrite policy would do, nobody is asked
+		f.reportDryRun(pm.ID, f.planWrites(hashes), skipped, problems, insp.reports)
+		return
 	}
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		log.Printf("error reading pak data: %v\n", err)
-		msg := "sorry, I was unable to process " + filename
-		f.session.ChannelMessageSend(pm.ID, msg)
+	ok, warning := f.checkMissingAssets(pm, insp.missing)
+	if !ok {
 		return
 	}
-	pakfile, err := pak.Unmarshal(data)
+	hashes, err := hashAssets(archive, entries)
 	if err != nil {
-		log.Printf("error unmarshalling pak data: %v\n", err)
-		msg := fmt.Sprintf("%q invalid pak file", filename)
-		f.session.ChannelMessageSend(pm.ID, msg)
+		f.rejectLimit(pm, err)
 		return
 	}
-	filesAdded := 0
-	for _, f := range pakfile.GetFiles() {
-		if hasPrefix(f.GetName(), []string{"maps/", "models/", "textures/", "env/", "sounds/", "pics/", "players/"}) {
-			err = writePakFileToRepo(f)
-			if err != nil {
-				log.Println(err)
-				continue
+	plan := f.planWrites(hashes)
+	if len(plan.confirm) > 0 {
+		f.confirmOverwrite(pm, plan.confirm)
+		return
+	}
+	if len(hashes) > 0 && plan.writes() == 0 {
+		f.reportNoop(pm, plan)
+		return
+	}
+	var filesAdded []string
+	var size int64
+	for _, e := range entries {
+		dest, ok := plan.dest[e.Name]
+		if !ok {
+			continue
+		}
+		fullpath, err := f.outputPath(dest)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		err = writeEntryToRepo(archive, e.Name, fullpath)
+		if err != nil {
+			log.Println(err)
+			// over the limit, none of it gets used
+			var tooBig *limitError
+			overLimit := errors.As(err, &tooBig)
+			undo := []string{dest}
+			if overLimit {
+				undo = append(undo, filesAdded...)
+			}
+			// don't leave half a file behind in the repo
+			if f.stageDir == "" {
+				if rerr := NewGit(config.GetRepoPath()).restore(undo...); rerr != nil {
+					log.Println(rerr)
+				}
+			}
+			if overLimit {
+				f.rejectLimit(pm, tooBig)
+				return
 			}
-			filesAdded++
+			continue
 		}
+		filesAdded = append(filesAdded, dest)
+		size += e.Size
 	}
-	if filesAdded > 0 {
-		msg := fmt.Sprintf("Added %s, submitted by %s[%s]", f.name, f.message.Author.Username, f.message.Author.ID)
-		err = commitAndPush(msg)
-		if err != nil {
-			log.Println("git error:", err)
-			return
+	if len(filesAdded) > 0 {
+		msg := fmt.Sprintf("Files in `%s` (%s) have been committed to the our git repo", f.name, formatSize(archive.Size()))
+		if summary := plan.summary(); summary != "" {
+			msg += "\n" + summary
+		}
+		if warning != "" {
+			msg += "\n" + warning
 		}
-		msg = fmt.Sprintf("Files in `%s` have been committed to the our git repo", f.name)
+		// the reports go last, they're what gets cut if there are lots of maps
+		msg = truncateMessage(msg+"\n"+insp.reports, maxReportLength)
+		f.finish(pm, filesAdded, size, msg, insp.previews)
+	} else {
+		msg := fmt.Sprintf("`%s` contains an invalid file structure. It should contain top-level folders matching a mod directory:\n", f.name)
+		msg += "```\n" + strings.Join(assetDirs, "...\n") + "...\n```"
 		f.session.ChannelMessageSend(pm.ID, msg)
-		log.Printf("%q committed to git repo", f.name)
 	}
 }
 
-// Write a file from a PAK archive to the local git repo.
-func writePakFileToRepo(f *proto.PAKFile) error {
-	fullpath := path.Join(config.GetRepoPath(), f.Name)
-	err := os.MkdirAll(filepath.Dir(fullpath), 0755)
-	if err != nil {
-		return fmt.Errorf("error creating full path: %v", err)
+// hashAssets hashes the files in an archive that would be written to the
+// repo, by name. Files that can't be read are left out, the only error is
+// going over a limit.
+func hashAssets(archive AssetArchive, entries []ArchiveEntry) (map[string][32]byte, error) {
+	hashes := map[string][32]byte{}
+	for _, e := range entries {
+		if e.Dir || !hasPrefix(e.Name, assetDirs) {
+			continue
+		}
+		if e.Hashed {
+			hashes[e.Name] = e.Sum
+			continue
+		}
+		sum, err := hashEntry(archive, e.Name)
+		var tooBig *limitError
+		if errors.As(err, &tooBig) {
+			return nil, tooBig
+		}
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		hashes[e.Name] = sum
 	}
-	err = os.WriteFile(fullpath, f.Data, 0644)
-	if err != nil {
-		return fmt.Errorf("error writing %q to repo: %v", fullpath, err)
+	return hashes, nil
+}
+
+// discard removes the upload's temp file, and its stage directory unless
+// it's waiting for review.
+func (f *FileUpload) discard() {
+	os.Remove(f.localName)
+	if f.stageDir != "" && !f.staged {
+		os.RemoveAll(f.stageDir)
+	}
+}
+
+// outputPath is where a file from an upload should be written, dest is
+// relative to the repo. Moderated uploads are written to their stage
+// directory instead of the repo. It's an error for dest to lead anywhere
+// else.
+func (f *FileUpload) outputPath(dest string) (string, error) {
+	if f.stageDir != "" {
+		return safeJoin(f.stageDir, dest)
+	}
+	return safeJoin(config.GetRepoPath(), dest)
+}
+
+// rejectUnsafe tells the uploader their archive won't be used because some
+// of the files in it have names that aren't safe to extract.
+func (f *FileUpload) rejectUnsafe(pm *discordgo.Channel, problems []string) {
+	list := strings.Join(problems, "\n")
+	if len(list) > 1500 {
+		list = list[:1500] + "\n..."
 	}
-	return nil
+	msg := fmt.Sprintf("`%s` was rejected, it has files with names that aren't allowed:\n```\n%s\n```", f.name, list)
+	f.session.ChannelMessageSend(pm.ID, msg)
+	log.Printf("%q rejected, %d unsafe file names\n", f.name, len(problems))
 }
 
-// Add any new files in the repo to be tracked by git, then commit and upload.
-func commitAndPush(msg string) error {
+// finish adds the files an upload wrote to the repo to its message's batch,
+// they're committed together once every attachment has been handled.
+// Moderated uploads are sent for review instead, and committed once
+// approved.
+func (f *FileUpload) finish(pm *discordgo.Channel, files []string, size int64, report string, previews []*discordgo.File) {
+	if f.stageDir != "" {
+		f.submitForReview(pm, files, size, report, previews)
+		return
+	}
+	f.batch.add(&batchedUpload{
+		upload:   f,
+		pm:       pm,
+		files:    files,
+		size:     size,
+		report:   report,
+		previews: previews,
+	})
+}
+
+// Stage the changes to files (relative to the repo), then commit and upload.
+// Returns the hash of the new commit. If it was committed but couldn't be
+// pushed the hash is returned along with errPushPending.
+func commitAndPush(msg, author string, files []string) (string, error) {
 	git := NewGit(config.RepoPath)
-	err := git.add()
+	err := git.add(files...)
 	if err != nil {
 		log.Println(err)
-		return err
+		return "", err
 	}
-	err = git.commit(msg)
+	commit, err := git.commit(msg, author)
 	if err != nil {
 		log.Println(err)
-		return err
+		return "", err
+	}
+	err = pushWithRetry(git)
+	// rebasing while retrying changes the hash
+	if head, herr := git.head(); herr == nil {
+		commit = head
 	}
-	err = git.Push()
 	if err != nil {
 		log.Println(err)
-		return err
+		return commit, fmt.Errorf("%w: %v", errPushPending, err)
+	}
+	return commit, nil
+}
+
+// maxReportLength leaves room in a Discord message (2000 characters) for
+// what's added to a report once it's committed, like a pull request link.
+const maxReportLength = 1700
+
+// truncateMessage cuts msg down to at most limit characters, closing any
+// code block left open.
+func truncateMessage(msg string, limit int) string {
+	if len(msg) <= limit {
+		return msg
+	}
+	cut := max(limit-10, 0)
+	// don't split a character
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+	msg = msg[:cut]
+	if strings.Count(msg, "```")%2 == 1 {
+		return msg + "\n...```"
+	}
+	return msg + "\n..."
+}
+
+// listNames is the first few names, one per line, and how many more there
+// are, for messages that could otherwise list hundreds.
+func listNames(names []string, limit int) string {
+	if len(names) <= limit {
+		return strings.Join(names, "\n")
+	}
+	return fmt.Sprintf("%s\n... and %d more", strings.Join(names[:limit], "\n"), len(names)-limit)
+}
+
+// reportNoop tells the uploader nothing was committed because of what's
+// already in the repo.
+func (f *FileUpload) reportNoop(pm *discordgo.Channel, plan *writePlan) {
+	msg := fmt.Sprintf("Nothing from `%s` was committed:\n%s", f.name, plan.summary())
+	f.session.ChannelMessageSend(pm.ID, msg)
+	log.Printf("%q not committed, nothing new\n", f.name)
+}
+
+// reportDryRun will tell the uploader what would have happened if this
+// wasn't a dry run.
+func (f *FileUpload) reportDryRun(channelID string, plan *writePlan, skipped, problems []string, reports string) {
+	msg := fmt.Sprintf("Validated `%s`, nothing was committed.\n", f.name)
+	var writes []string
+	for _, dest := range plan.dest {
+		writes = append(writes, dest)
+	}
+	sort.Strings(writes)
+	if len(writes) > 0 {
+		msg += fmt.Sprintf("Would commit %d files:\n```\n%s\n```", len(writes), strings.Join(writes, "\n"))
+	} else {
+		msg += "Nothing would be committed.\n"
+	}
+	if summary := plan.summary(); summary != "" {
+		msg += summary + "\n"
+	}
+	if len(plan.confirm) > 0 {
+		msg += fmt.Sprintf("Would need someone allowed to replace files to confirm: `%s`\n", strings.Join(plan.confirm, "`, `"))
+	}
+	if len(skipped) > 0 {
+		msg += fmt.Sprintf("Would skip %d files (not in a mod directory):\n```\n%s\n```", len(skipped), strings.Join(skipped, "\n"))
+	}
+	if len(problems) > 0 {
+		msg += fmt.Sprintf("Problems:\n```\n%s\n```", strings.Join(problems, "\n"))
+	}
+	msg += reports
+	msg = truncateMessage(msg, 2000)
+	f.session.ChannelMessageSend(channelID, msg)
+	log.Printf("%q validated (dry run)\n", f.name)
+}
+
+// recordUpload saves the details of a successful upload to the history.
+func (f *FileUpload) recordUpload(files []string, size int64, commit string) {
+	err := store.AddUpload(&pb.UploadRecord{
+		Timestamp: time.Now().Unix(),
+		UserId:    f.message.Author.ID,
+		Username:  f.message.Author.Username,
+		Filename:  f.name,
+		Files:     files,
+		Bytes:     size,
+		Commit:    commit,
+	})
+	if err != nil {
+		log.Printf("error recording upload of %q: %v\n", f.name, err)
 	}
-	return nil
 }
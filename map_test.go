@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateMessage(t *testing.T) {
+	tests := []struct {
+		msg   string
+		limit int
+	}{
+		{"short", 2000},
+		{strings.Repeat("x", 3000), 2000},
+		{"```\n" + strings.Repeat("maps/q2dm1.bsp\n", 300) + "```", 2000},
+		{strings.Repeat("é", 1500), 2000},
+		{strings.Repeat("x", 50), 5},
+	}
+	for _, tc := range tests {
+		got := truncateMessage(tc.msg, tc.limit)
+		if len(got) > max(tc.limit, 15) {
+			t.Errorf("truncateMessage() is %d long, limit %d", len(got), tc.limit)
+		}
+		if strings.Count(got, "```")%2 != 0 {
+			t.Errorf("truncateMessage() left a code block open: %q", got)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateMessage() split a character")
+		}
+		if len(tc.msg) <= tc.limit && got != tc.msg {
+			t.Errorf("truncateMessage(%q) = %q, shouldn't change", tc.msg, got)
+		}
+	}
+}
+
+func TestListNames(t *testing.T) {
+	var names []string
+	for i := 0; i < 300; i++ {
+		names = append(names, fmt.Sprintf("textures/e1u1/texture%d.wal", i))
+	}
+	if got := listNames(names[:3], 20); got != strings.Join(names[:3], "\n") {
+		t.Errorf("listNames() of a short list = %q", got)
+	}
+	got := listNames(names, 20)
+	if lines := strings.Split(got, "\n"); len(lines) != 21 || lines[20] != "... and 280 more" {
+		t.Errorf("listNames() = %q", got)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/packetflinger/libq2/bsp"
+)
+
+const maxSearchResults = 30
+
+// mapInfo is what we know about a map in the repo.
+type mapInfo struct {
+	name            string // without the .bsp extension
+	size            int64
+	entities        int
+	textures        int
+	missingTextures []string
+	commit          string
+	author          string
+	committed       time.Time
+}
+
+// Reading every BSP and asking git about it is slow, so keep the results
+// around until something new is committed to the repo.
+var (
+	mapCache     = map[string]*mapInfo{}
+	mapCacheHead string // commit the cache is valid for
+	mapCacheMu   sync.Mutex
+)
+
+// checkMapCache throws away cached map info if the repo has moved on since it
+// was cached. The caller must hold mapCacheMu.
+func checkMapCache() {
+	head, err := NewGit(config.GetRepoPath()).head()
+	if err != nil {
+		log.Println(err)
+		head = ""
+	}
+	if head != mapCacheHead || head == "" {
+		mapCache = map[string]*mapInfo{}
+		mapCacheHead = head
+	}
+}
+
+// cmdMapsSearch will list the maps in the repo matching a pattern. The
+// pattern can use shell wildcards ("q2dm*"), otherwise any map containing it
+// matches.
+func cmdMapsSearch(r *commandRequest) {
+	if len(r.args) != 1 {
+		r.reply("Usage: `!maps search <pattern>`")
+		return
+	}
+	matches, err := searchMaps(r.args[0])
+	if err != nil {
+		log.Println("error searching maps:", err)
+		r.reply("Sorry, I couldn't search the maps")
+		return
+	}
+	if len(matches) == 0 {
+		r.reply(fmt.Sprintf("No maps match `%s`", r.args[0]))
+		return
+	}
+	output := fmt.Sprintf("%d maps match `%s`", len(matches), r.args[0])
+	if len(matches) > maxSearchResults {
+		output += fmt.Sprintf(", showing the first %d", maxSearchResults)
+		matches = matches[:maxSearchResults]
+	}
+	r.reply(fmt.Sprintf("%s:\n`%s`", output, strings.Join(matches, "`, `")))
+}
+
+// cmdMapsInfo will reply with the details of a map in the repo.
+func cmdMapsInfo(r *commandRequest) {
+	if len(r.args) != 1 {
+		r.reply("Usage: `!maps info <name>`")
+		return
+	}
+	name := trimBSP(r.args[0])
+	info, err := lookupMap(name)
+	if os.IsNotExist(err) {
+		r.reply(fmt.Sprintf("There's no map called `%s`", name))
+		return
+	}
+	if err != nil {
+		log.Printf("error reading map %q: %v\n", name, err)
+		r.reply(fmt.Sprintf("Sorry, I couldn't read `%s`", name))
+		return
+	}
+	r.reply(formatMapInfo(info))
+}
+
+// cmdMapsDelete will remove a map from the repo, commit and push. Textures
+// and other files it used are left alone, other maps may need them.
+func cmdMapsDelete(r *commandRequest) {
+	if len(r.args) != 1 {
+		r.reply("Usage: `!maps delete <name>`")
+		return
+	}
+	name := trimBSP(r.args[0])
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		r.reply(fmt.Sprintf("`%s` isn't a valid map name", name))
+		return
+	}
+	what := fmt.Sprintf("deleting `%s`", name)
+	ahead, ok := repoJobs.add(&repoJob{
+		description: fmt.Sprintf("%s for %s", what, r.user.Username),
+		run:         func() { deleteMap(r, name) },
+	})
+	if !ok {
+		r.reply(queueFullMessage(what))
+		return
+	}
+	if msg := queuedMessage(what, ahead); msg != "" {
+		r.reply(msg)
+	}
+}
+
+// deleteMap removes a map from the repo and commits, run from the repo
+// queue.
+func deleteMap(r *commandRequest, name string) {
+	file, err := findMap(name)
+	if os.IsNotExist(err) {
+		r.reply(fmt.Sprintf("There's no map called `%s`", name))
+		return
+	}
+	if err != nil {
+		log.Printf("error looking for %q: %v\n", name, err)
+		r.reply(fmt.Sprintf("Sorry, I couldn't delete `%s`", name))
+		return
+	}
+	relpath := path.Join("maps", file)
+	err = os.Remove(path.Join(config.GetRepoPath(), relpath))
+	if os.IsNotExist(err) {
+		r.reply(fmt.Sprintf("There's no map called `%s`", name))
+		return
+	}
+	if err != nil {
+		log.Printf("error deleting %q: %v\n", relpath, err)
+		r.reply(fmt.Sprintf("Sorry, I couldn't delete `%s`", name))
+		return
+	}
+	msg := fmt.Sprintf("Removed %s, requested by %s[%s]", relpath, r.user.Username, r.user.ID)
+	_, prURL, err := commitUpload(&commitRequest{
+		session:  r.session,
+		message:  msg,
+		author:   commitAuthor(r.user.Username, r.user.ID),
+		username: r.user.Username,
+		filename: "delete-" + name,
+		files:    []string{relpath},
+	})
+	if errors.Is(err, errPushPending) {
+		r.reply(fmt.Sprintf("`%s` has been removed. %s", name, pushPendingNote))
+		return
+	}
+	if err != nil {
+		log.Println("git error:", err)
+		r.reply(fmt.Sprintf("Sorry, I couldn't delete `%s`", name))
+		return
+	}
+	log.Printf("%q deleted by %s\n", relpath, r.user.ID)
+	if prURL != "" {
+		r.reply(fmt.Sprintf("Removing `%s` is ready to merge: %s", name, prURL))
+		return
+	}
+	r.reply(fmt.Sprintf("`%s` has been removed from the repo", name))
+}
+
+// searchMaps returns the names (without extension) of the maps in the repo
+// matching the pattern, sorted. Matching ignores case.
+func searchMaps(pattern string) ([]string, error) {
+	pattern = strings.ToLower(pattern)
+	if !strings.ContainsAny(pattern, "*?[") {
+		pattern = "*" + pattern + "*"
+	}
+	entries, err := os.ReadDir(path.Join(config.GetRepoPath(), "maps"))
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.EqualFold(path.Ext(e.Name()), ".bsp") {
+			continue
+		}
+		name := trimBSP(e.Name())
+		ok, err := filepath.Match(pattern, strings.ToLower(name))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, name)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i]) < strings.ToLower(out[j]) })
+	return out, nil
+}
+
+// findMap returns the file name in maps/ for a map name (without
+// extension), whatever case either is in. The error is os.ErrNotExist if
+// there isn't one.
+func findMap(name string) (string, error) {
+	dir := path.Join(config.GetRepoPath(), "maps")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.EqualFold(path.Ext(e.Name()), ".bsp") {
+			continue
+		}
+		if strings.EqualFold(trimBSP(e.Name()), name) {
+			return e.Name(), nil
+		}
+	}
+	return "", &os.PathError{Op: "find", Path: path.Join(dir, name+".bsp"), Err: os.ErrNotExist}
+}
+
+// trimBSP removes the .bsp extension (in any case) from a map name.
+func trimBSP(name string) string {
+	if strings.EqualFold(path.Ext(name), ".bsp") {
+		return name[:len(name)-len(".bsp")]
+	}
+	return name
+}
+
+// lookupMap returns the details of a map, from the cache if we can. The
+// name can be in any case.
+func lookupMap(name string) (*mapInfo, error) {
+	mapCacheMu.Lock()
+	defer mapCacheMu.Unlock()
+	checkMapCache()
+	key := strings.ToLower(name)
+	if info, ok := mapCache[key]; ok {
+		return info, nil
+	}
+	file, err := findMap(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := readMapInfo(file)
+	if err != nil {
+		return nil, err
+	}
+	mapCache[key] = info
+	return info, nil
+}
+
+// readMapInfo will open a map in the repo and gather its details. file is
+// the name in maps/, with the extension.
+func readMapInfo(file string) (*mapInfo, error) {
+	relpath := path.Join("maps", file)
+	fullpath := path.Join(config.GetRepoPath(), relpath)
+	st, err := os.Stat(fullpath)
+	if err != nil {
+		return nil, err
+	}
+	bspfile, err := bsp.OpenBSPFile(fullpath)
+	if err != nil {
+		return nil, err
+	}
+	defer bspfile.Close()
+	info := &mapInfo{
+		name:            trimBSP(file),
+		size:            st.Size(),
+		entities:        len(bspfile.Ents),
+		textures:        len(bspfile.FetchTextures()),
+		missingTextures: missingTextures(bspfile),
+	}
+	info.commit, info.author, info.committed, err = NewGit(config.GetRepoPath()).lastCommit(relpath)
+	if err != nil {
+		log.Println(err)
+	}
+	return info, nil
+}
+
+// textureNames returns the unique texture names (ex: "e1u1/floor1_3") used
+// by a map.
+func textureNames(bspfile *bsp.BSPFile) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, t := range bspfile.FetchTextures() {
+		name := strings.ToLower(strings.TrimRight(t.File, "\x00 "))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// missingTextures returns the textures used by a map that aren't in the
+// repo, in any of the formats a texture can be.
+func missingTextures(bspfile *bsp.BSPFile) []string {
+	var missing []string
+	for _, t := range textureNames(bspfile) {
+		found := false
+		for _, p := range texturePaths(t) {
+			if inRepo(p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, t)
+		}
+	}
+	return missing
+}
+
+// fileExists is true if the path exists and is a regular file.
+func fileExists(name string) bool {
+	st, err := os.Stat(name)
+	return err == nil && st.Mode().IsRegular()
+}
+
+// how many missing textures are named in a map's details, a map on its own
+// can be missing hundreds
+const maxInfoTextures = 20
+
+// formatMapInfo builds the reply for a map's details.
+func formatMapInfo(info *mapInfo) string {
+	output := fmt.Sprintf("`%s`\n```\n  %d bytes\n  %d entities\n  %d textures\n", info.name, info.size, info.entities, info.textures)
+	if len(info.missingTextures) > 0 {
+		output += fmt.Sprintf("  %d missing textures:\n", len(info.missingTextures))
+		for _, t := range strings.Split(listNames(info.missingTextures, maxInfoTextures), "\n") {
+			output += "    " + t + "\n"
+		}
+	}
+	output += "```"
+	if info.commit != "" {
+		output += fmt.Sprintf("Committed by %s <t:%d:R> (`%s`)", info.author, info.committed.Unix(), info.commit[:8])
+	}
+	return output
+}
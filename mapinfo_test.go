@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatMapInfo(t *testing.T) {
+	info := &mapInfo{
+		name:      "q2dm1",
+		size:      1234567,
+		entities:  300,
+		textures:  400,
+		commit:    "0123456789abcdef0123456789abcdef01234567",
+		author:    "someone",
+		committed: time.Unix(1700000000, 0),
+	}
+	for i := 0; i < 400; i++ {
+		info.missingTextures = append(info.missingTextures, fmt.Sprintf("some_texture_dir/texture_number_%d", i))
+	}
+	got := formatMapInfo(info)
+	if len(got) > 2000 {
+		t.Errorf("formatMapInfo() is %d long", len(got))
+	}
+	for _, want := range []string{"400 missing textures", info.missingTextures[0], "... and 380 more", "`01234567`"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("formatMapInfo() doesn't mention %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, info.missingTextures[maxInfoTextures]) {
+		t.Errorf("formatMapInfo() lists more than %d textures", maxInfoTextures)
+	}
+}
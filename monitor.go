@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/packetflinger/libq2/state"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+const (
+	defaultPollInterval  = 60 // seconds
+	defaultStatusHistory = 7  // days
+)
+
+// serverPoll is the result of asking one configured server for its status.
+type serverPoll struct {
+	server *pb.Server
+	info   state.ServerInfo
+	err    error
+}
+
+// runServerMonitor will poll every configured server on an interval and pass
+// the results along to everything that cares about them (the status board,
+// population alerts, watchlists). This never returns, run it in a goroutine.
+func runServerMonitor(s *discordgo.Session) {
+	if len(config.GetServers()) == 0 {
+		return
+	}
+	interval := time.Duration(config.GetPollInterval()) * time.Second
+	if interval <= 0 {
+		interval = defaultPollInterval * time.Second
+	}
+	log.Printf("polling %d servers every %v\n", len(config.GetServers()), interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, srv := range config.GetServers() {
+			p := pollServer(srv)
+			recordStatus(p)
+			updateStatusBoard(s, p)
+			checkAlerts(s, p)
+			checkWatchlists(s, p)
+		}
+		days := config.GetStatusHistoryDays()
+		if days <= 0 {
+			days = defaultStatusHistory
+		}
+		err := store.PruneServerStatus(time.Now().AddDate(0, 0, -int(days)))
+		if err != nil {
+			log.Println("error pruning status history:", err)
+		}
+		<-ticker.C
+	}
+}
+
+// pollServer fetches the current status of a configured server.
+func pollServer(srv *pb.Server) serverPoll {
+	p := serverPoll{server: srv}
+	q2, err := state.NewServer(srv.GetAddress())
+	if err != nil {
+		p.err = err
+		return p
+	}
+	p.info, p.err = q2.FetchInfo()
+	return p
+}
+
+// recordStatus will save the result of a poll to the status history.
+func recordStatus(p serverPoll) {
+	rec := &pb.StatusRecord{
+		Timestamp: time.Now().Unix(),
+		Alias:     p.server.GetAlias(),
+		Online:    p.err == nil,
+	}
+	if p.err == nil {
+		players, _ := strconv.Atoi(p.info.Server["player_count"])
+		maxclients, _ := strconv.Atoi(p.info.Server["maxclients"])
+		rec.Map = p.info.Server["mapname"]
+		rec.Players = int32(players)
+		rec.MaxPlayers = int32(maxclients)
+	}
+	err := store.AddServerStatus(rec)
+	if err != nil {
+		log.Printf("error recording status of %q: %v\n", p.server.GetAlias(), err)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+const (
+	confirmTimeout = 10 * time.Minute
+	emojiApprove   = "✅"
+	emojiReject    = "❌"
+)
+
+// writePlan says where each file from an upload should be written in the
+// repo, after taking into account what's already there.
+type writePlan struct {
+	dest      map[string]string // upload name -> repo path, missing means skip
+	identical []string          // already in the repo, byte for byte
+	replaced  []string          // will overwrite a different file
+	versioned []string          // written under a new name, "old -> new"
+	refused   []string          // different file exists and policy says no
+	confirm   []string          // someone needs to be asked before anything is written
+}
+
+// writes is how many files the plan will actually write.
+func (p *writePlan) writes() int {
+	return len(p.dest)
+}
+
+// summary describes anything unusual about the plan for the uploader.
+func (p *writePlan) summary() string {
+	var out []string
+	if len(p.identical) > 0 {
+		out = append(out, fmt.Sprintf("%d files unchanged (already in the repo)", len(p.identical)))
+	}
+	if len(p.replaced) > 0 {
+		out = append(out, fmt.Sprintf("replaced: `%s`", strings.Join(p.replaced, "`, `")))
+	}
+	if len(p.versioned) > 0 {
+		out = append(out, fmt.Sprintf("added as new versions: `%s`", strings.Join(p.versioned, "`, `")))
+	}
+	if len(p.refused) > 0 {
+		out = append(out, fmt.Sprintf("not replaced: `%s`", strings.Join(p.refused, "`, `")))
+	}
+	return strings.Join(out, "\n")
+}
+
+// hashFile returns the sha256 of a file, or false if it can't be read.
+func hashFile(name string) ([32]byte, bool) {
+	var sum [32]byte
+	fp, err := os.Open(name)
+	if err != nil {
+		return sum, false
+	}
+	defer fp.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return sum, false
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, true
+}
+
+// planWrites compares the files in an upload (name -> content hash) with the
+// repo and applies the overwrite policy. Names are matched against the repo
+// ignoring case, a file that's already there under another case is the one
+// compared and written to. Uploaders allowed to overwrite files skip the
+// policy. If the policy is to ask and nobody has been asked about a file
+// yet, it's listed in confirm and the upload has to wait, see
+// confirmOverwrite.
+func (f *FileUpload) planWrites(hashes map[string][32]byte) *writePlan {
+	plan := &writePlan{dest: map[string]string{}}
+	var changed []string
+	existingName := map[string]string{} // repo path -> upload name
+	for name, sum := range hashes {
+		repoName, found := findRepoFile(name)
+		existing, ok := hashFile(path.Join(config.GetRepoPath(), repoName))
+		switch {
+		case !found || !ok:
+			plan.dest[name] = repoName
+		case existing == sum:
+			plan.identical = append(plan.identical, repoName)
+		default:
+			changed = append(changed, repoName)
+			existingName[repoName] = name
+		}
+	}
+	sort.Strings(plan.identical)
+	sort.Strings(changed)
+	if len(changed) == 0 {
+		return plan
+	}
+
+	m := f.message
+	if authorized(f.session, m.GuildID, m.Author.ID, m.Member, pb.Capability_OVERWRITE) {
+		for _, repoName := range changed {
+			plan.dest[existingName[repoName]] = repoName
+			plan.replaced = append(plan.replaced, repoName)
+		}
+		return plan
+	}
+
+	switch config.GetOverwrite() {
+	case pb.OverwritePolicy_CONFIRM:
+		for _, repoName := range changed {
+			approved, answered := f.overwrite[repoName]
+			switch {
+			case !answered:
+				plan.confirm = append(plan.confirm, repoName)
+			case approved:
+				plan.dest[existingName[repoName]] = repoName
+				plan.replaced = append(plan.replaced, repoName)
+			default:
+				plan.refused = append(plan.refused, repoName)
+			}
+		}
+	case pb.OverwritePolicy_VERSION:
+		for _, repoName := range changed {
+			// renaming a texture or sound would break the maps using it, so
+			// only maps get versions
+			if !strings.HasSuffix(strings.ToLower(repoName), ".bsp") {
+				plan.refused = append(plan.refused, repoName)
+				continue
+			}
+			name := existingName[repoName]
+			newName, identical := nextVersion(repoName, hashes[name])
+			if identical {
+				plan.identical = append(plan.identical, newName)
+				continue
+			}
+			plan.dest[name] = newName
+			plan.versioned = append(plan.versioned, fmt.Sprintf("%s -> %s", repoName, newName))
+		}
+	default:
+		plan.refused = changed
+	}
+	return plan
+}
+
+// findRepoFile matches a path (relative to the repo) against what's in the
+// repo ignoring case. Each part of it that exists is given the case it has
+// in the repo, so an upload can't add a second copy of a file or directory
+// that differs only by case. found says whether the whole path exists.
+func findRepoFile(name string) (repoName string, found bool) {
+	dir := config.GetRepoPath()
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		match, ok := findDirEntry(path.Join(dir, path.Join(parts[:i]...)), part)
+		if !ok {
+			return strings.Join(parts, "/"), false
+		}
+		parts[i] = match
+	}
+	return strings.Join(parts, "/"), true
+}
+
+// findDirEntry returns the name of the entry in dir matching name, an exact
+// match if there is one, otherwise ignoring case.
+func findDirEntry(dir, name string) (string, bool) {
+	if _, err := os.Lstat(path.Join(dir, name)); err == nil {
+		return name, true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), name) {
+			return e.Name(), true
+		}
+	}
+	return "", false
+}
+
+// nextVersion finds the first free versioned name for a file
+// ("maps/q2dm1.bsp" -> "maps/q2dm1_v2.bsp"). If one of the existing versions
+// has the same content, that name is returned along with true.
+func nextVersion(name string, sum [32]byte) (string, bool) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for v := 2; ; v++ {
+		candidate, found := findRepoFile(fmt.Sprintf("%s_v%d%s", base, v, ext))
+		if !found {
+			return candidate, false
+		}
+		existing, ok := hashFile(path.Join(config.GetRepoPath(), candidate))
+		if !ok {
+			return candidate, false
+		}
+		if existing == sum {
+			return candidate, true
+		}
+	}
+}
+
+// confirmOverwrite asks someone allowed to overwrite files to approve
+// replacing them by reacting to a message in the upload channel. The upload
+// is parked rather than holding up the repo queue while we wait, once
+// there's an answer it's queued to be processed again.
+func (f *FileUpload) confirmOverwrite(pm *discordgo.Channel, changed []string) {
+	msg := fmt.Sprintf(
+		"<@%s> uploaded `%s`, which would replace existing files:\n```\n%s\n```Someone allowed to replace files needs to react %s to allow it or %s to refuse.",
+		f.message.Author.ID, f.name, strings.Join(changed, "\n"), emojiApprove, emojiReject,
+	)
+	f.parked = true
+	f.session.ChannelMessageSend(pm.ID, fmt.Sprintf("`%s` would replace files already in the repo, I've asked for someone to allow it.", f.name))
+	go func() {
+		ok := requestConfirmation(f.session, f.message.ChannelID, msg, func(r *discordgo.MessageReactionAdd) bool {
+			return authorized(f.session, r.GuildID, r.UserID, r.Member, pb.Capability_OVERWRITE)
+		})
+		log.Printf("overwrite by %q approved: %v\n", f.name, ok)
+		if f.overwrite == nil {
+			f.overwrite = map[string]bool{}
+		}
+		for _, name := range changed {
+			f.overwrite[name] = ok
+		}
+		f.resume(pm)
+	}()
+}
+
+// resume queues a parked upload to be processed again, in its own batch
+// since the one it came in with has moved on.
+func (f *FileUpload) resume(pm *discordgo.Channel) {
+	f.batch = &uploadBatch{}
+	what := fmt.Sprintf("`%s`", f.name)
+	ahead, ok := repoJobs.add(&repoJob{
+		description: fmt.Sprintf("%s from %s", what, f.message.Author.Username),
+		run: func() {
+			f.process()
+			f.batch.commit()
+		},
+	})
+	if !ok {
+		f.discard()
+		f.session.ChannelMessageSend(pm.ID, queueFullMessage(what))
+		return
+	}
+	if msg := queuedMessage(what, ahead); msg != "" {
+		f.session.ChannelMessageSend(pm.ID, msg)
+	}
+}
+
+// Confirmations we're waiting for, keyed by the message ID people react to.
+var (
+	pendingConfirms   = map[string]*pendingConfirm{}
+	pendingConfirmsMu sync.Mutex
+)
+
+type pendingConfirm struct {
+	allowed func(*discordgo.MessageReactionAdd) bool // who can answer
+	result  chan bool
+}
+
+// requestConfirmation posts a message with approve/reject reactions and
+// waits for an allowed user to pick one. No answer before the timeout is
+// treated as a rejection.
+func requestConfirmation(s *discordgo.Session, channelID, content string, allowed func(*discordgo.MessageReactionAdd) bool) bool {
+	msg, err := s.ChannelMessageSend(channelID, content)
+	if err != nil {
+		log.Println("error posting confirmation request:", err)
+		return false
+	}
+	s.MessageReactionAdd(channelID, msg.ID, emojiApprove)
+	s.MessageReactionAdd(channelID, msg.ID, emojiReject)
+
+	pc := &pendingConfirm{allowed: allowed, result: make(chan bool, 1)}
+	pendingConfirmsMu.Lock()
+	pendingConfirms[msg.ID] = pc
+	pendingConfirmsMu.Unlock()
+	defer func() {
+		pendingConfirmsMu.Lock()
+		delete(pendingConfirms, msg.ID)
+		pendingConfirmsMu.Unlock()
+	}()
+
+	select {
+	case ok := <-pc.result:
+		return ok
+	case <-time.After(confirmTimeout):
+		s.ChannelMessageSend(channelID, "Nobody answered in time, so that's a no.")
+		return false
+	}
+}
+
+// handleReactionAdd is called for every reaction added to a message.
+func handleReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if r.UserID == s.State.User.ID {
+		return
+	}
+	if handleReviewReaction(s, r) {
+		return
+	}
+	pendingConfirmsMu.Lock()
+	pc, ok := pendingConfirms[r.MessageID]
+	pendingConfirmsMu.Unlock()
+	if !ok || !pc.allowed(r) {
+		return
+	}
+	var answer bool
+	switch r.Emoji.Name {
+	case emojiApprove:
+		answer = true
+	case emojiReject:
+		answer = false
+	default:
+		return
+	}
+	select {
+	case pc.result <- answer:
+	default: // already answered
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+func TestFindRepoFile(t *testing.T) {
+	repo := t.TempDir()
+	old := config
+	config = &pb.BotConfig{RepoPath: repo}
+	t.Cleanup(func() { config = old })
+	writeRepoFile(t, repo, "maps/q2dm1.bsp", "the edge")
+	writeRepoFile(t, repo, "textures/E1U1/Floor.wal", "a texture")
+
+	tests := []struct {
+		name  string
+		want  string
+		found bool
+	}{
+		{"maps/q2dm1.bsp", "maps/q2dm1.bsp", true},
+		{"maps/Q2DM1.bsp", "maps/q2dm1.bsp", true},
+		{"MAPS/q2dm1.BSP", "maps/q2dm1.bsp", true},
+		{"textures/e1u1/floor.wal", "textures/E1U1/Floor.wal", true},
+		{"textures/e1u1/new.wal", "textures/E1U1/new.wal", false},
+		{"Maps/new.bsp", "maps/new.bsp", false},
+		{"sound/world/amb1.wav", "sound/world/amb1.wav", false},
+	}
+	for _, tc := range tests {
+		got, found := findRepoFile(tc.name)
+		if got != tc.want || found != tc.found {
+			t.Errorf("findRepoFile(%q) = %q, %v, want %q, %v", tc.name, got, found, tc.want, tc.found)
+		}
+	}
+}
+
+// An upload differing from a file in the repo only by case gets the
+// overwrite policy like any other change.
+func TestPlanWritesCase(t *testing.T) {
+	repo := t.TempDir()
+	old := config
+	t.Cleanup(func() { config = old })
+	writeRepoFile(t, repo, "maps/q2dm1.bsp", "the edge")
+	writeRepoFile(t, repo, "maps/q2dm2.bsp", "tokay's towers")
+
+	upload := map[string][32]byte{
+		"maps/Q2DM1.bsp": sha256.Sum256([]byte("a new edge")),
+		"maps/Q2DM2.bsp": sha256.Sum256([]byte("tokay's towers")),
+		"Maps/q2dm3.bsp": sha256.Sum256([]byte("the frag pipe")),
+	}
+	f := &FileUpload{message: &discordgo.MessageCreate{Message: &discordgo.Message{Author: &discordgo.User{ID: "1"}}}}
+
+	tests := []struct {
+		policy pb.OverwritePolicy
+		answer map[string]bool
+		dest   map[string]string
+		check  func(*writePlan) []string
+	}{
+		{
+			policy: pb.OverwritePolicy_REFUSE,
+			dest:   map[string]string{"Maps/q2dm3.bsp": "maps/q2dm3.bsp"},
+			check:  func(p *writePlan) []string { return p.refused },
+		},
+		{
+			policy: pb.OverwritePolicy_CONFIRM,
+			dest:   map[string]string{"Maps/q2dm3.bsp": "maps/q2dm3.bsp"},
+			check:  func(p *writePlan) []string { return p.confirm },
+		},
+		{
+			policy: pb.OverwritePolicy_CONFIRM,
+			answer: map[string]bool{"maps/q2dm1.bsp": true},
+			dest:   map[string]string{"Maps/q2dm3.bsp": "maps/q2dm3.bsp", "maps/Q2DM1.bsp": "maps/q2dm1.bsp"},
+			check:  func(p *writePlan) []string { return p.replaced },
+		},
+		{
+			policy: pb.OverwritePolicy_VERSION,
+			dest:   map[string]string{"Maps/q2dm3.bsp": "maps/q2dm3.bsp", "maps/Q2DM1.bsp": "maps/q2dm1_v2.bsp"},
+			check:  func(p *writePlan) []string { return p.versioned },
+		},
+	}
+	for _, tc := range tests {
+		config = &pb.BotConfig{RepoPath: repo, Overwrite: tc.policy}
+		f.overwrite = tc.answer
+		plan := f.planWrites(upload)
+		if len(plan.dest) != len(tc.dest) {
+			t.Errorf("%v: dest = %v, want %v", tc.policy, plan.dest, tc.dest)
+		}
+		for name, dest := range tc.dest {
+			if plan.dest[name] != dest {
+				t.Errorf("%v: dest[%q] = %q, want %q", tc.policy, name, plan.dest[name], dest)
+			}
+		}
+		if got := tc.check(plan); len(got) != 1 || !strings.HasPrefix(got[0], "maps/q2dm1.bsp") {
+			t.Errorf("%v: q2dm1 listed as %q", tc.policy, got)
+		}
+		if strings.Join(plan.identical, ",") != "maps/q2dm2.bsp" {
+			t.Errorf("%v: identical = %q, want maps/q2dm2.bsp", tc.policy, plan.identical)
+		}
+	}
+}
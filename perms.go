@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+// What each capability lets someone do, for explaining why they can't.
+var capabilityActions = map[pb.Capability]string{
+	pb.Capability_UPLOAD:    "upload files to the repo",
+	pb.Capability_OVERWRITE: "replace files already in the repo",
+	pb.Capability_DELETE:    "delete maps from the repo",
+	pb.Capability_ADMIN:     "use admin commands",
+	pb.Capability_STATUS:    "look up servers and maps",
+	pb.Capability_MODERATE:  "review uploads",
+}
+
+// authorized is true if a user has a capability. Users in the admins list
+// can do everything. Otherwise the user or one of their roles needs to be
+// listed for the capability (or for ADMIN). Capabilities with nothing
+// configured are open to everyone if they're harmless (uploading and
+// status), and admin only if not.
+//
+// member is the user's guild membership if the event came with it, if not
+// it's looked up so roles can be checked.
+func authorized(s *discordgo.Session, guildID, userID string, member *discordgo.Member, c pb.Capability) bool {
+	if contains(userID, config.GetAdmins()) {
+		return true
+	}
+	configured := false
+	var roles []string
+	for _, p := range config.GetPermissions() {
+		if p.GetCapability() != c && p.GetCapability() != pb.Capability_ADMIN {
+			continue
+		}
+		if p.GetCapability() == c {
+			configured = true
+		}
+		if contains(userID, p.GetUsers()) {
+			return true
+		}
+		if len(p.GetRoles()) == 0 {
+			continue
+		}
+		if roles == nil {
+			roles = memberRoles(s, guildID, userID, member)
+		}
+		for _, r := range roles {
+			if contains(r, p.GetRoles()) {
+				return true
+			}
+		}
+	}
+	if !configured {
+		return c == pb.Capability_UPLOAD || c == pb.Capability_STATUS
+	}
+	return false
+}
+
+// memberRoles returns the role IDs a user has in a guild.
+func memberRoles(s *discordgo.Session, guildID, userID string, member *discordgo.Member) []string {
+	if member != nil && member.Roles != nil {
+		return member.Roles
+	}
+	if guildID == "" {
+		return []string{}
+	}
+	m, err := s.State.Member(guildID, userID)
+	if err != nil {
+		m, err = s.GuildMember(guildID, userID)
+		if err != nil {
+			log.Printf("unable to look up roles for %s: %v\n", userID, err)
+			return []string{}
+		}
+	}
+	return m.Roles
+}
+
+// denied explains to a user that they're missing a capability.
+func denied(c pb.Capability) string {
+	return "Sorry, you don't have permission to " + capabilityActions[c] + "."
+}
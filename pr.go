@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+// anything git or the forges might not like in a branch name
+var branchUnsafe = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// A change to the repo ready to commit, and who it's from.
+type commitRequest struct {
+	session  *discordgo.Session // for telling admins about problems
+	message  string
+	author   string   // "Name <email>", empty for git's default
+	username string   // Discord user, for naming branches
+	filename string   // what was uploaded
+	files    []string // paths in the repo
+}
+
+// commitAuthor is the git author for changes from a Discord user, or "" if
+// commits shouldn't be attributed to uploaders.
+func commitAuthor(username, userID string) string {
+	email := config.GetAuthorEmail()
+	if email == "" {
+		return ""
+	}
+	if strings.Contains(email, "%s") {
+		email = fmt.Sprintf(email, userID)
+	}
+	// git doesn't allow <> in names
+	username = strings.NewReplacer("<", "", ">", "").Replace(username)
+	return fmt.Sprintf("%s <%s>", username, email)
+}
+
+// commitUpload commits the files an upload wrote to the repo. Normally they
+// go straight onto the checked out branch and are pushed. If pull requests
+// are configured they go on a branch of their own instead and a pull request
+// is opened, its URL is returned.
+//
+// If it was committed but couldn't be pushed, or its pull request couldn't
+// be opened, the commit is returned along with errPushPending and the sync
+// finishes the job. Admins are told about any failure, the caller should
+// tell whoever asked. If nothing was committed the files are put back the
+// way they were.
+func commitUpload(req *commitRequest) (commit, prURL string, err error) {
+	commit, prURL, err = commitOrOpenPR(req)
+	switch {
+	case errors.Is(err, errPushPending):
+		notifyAdmins(req.session, fmt.Sprintf("\"%s\" is committed but isn't on the server yet, I'll keep trying:\n```\n%v\n```", req.message, err))
+	case err != nil:
+		notifyAdmins(req.session, fmt.Sprintf("I couldn't commit \"%s\":\n```\n%v\n```", req.message, err))
+		// don't leave the files for the next commit to pick up
+		if rerr := NewGit(config.GetRepoPath()).restore(req.files...); rerr != nil {
+			log.Println("unable to undo uncommitted changes:", rerr)
+			notifyAdmins(req.session, fmt.Sprintf("I couldn't undo the changes from \"%s\" either, the repo needs a hand:\n```\n%v\n```", req.message, rerr))
+		}
+	}
+	return commit, prURL, err
+}
+
+// commitOrOpenPR does the work for commitUpload.
+func commitOrOpenPR(req *commitRequest) (commit, prURL string, err error) {
+	cfg := config.GetPullRequests()
+	if cfg == nil {
+		commit, err = commitAndPush(req.message, req.author, req.files)
+		return commit, "", err
+	}
+	forge, err := newForge(cfg)
+	if err != nil {
+		return "", "", err
+	}
+	git := NewGit(config.GetRepoPath())
+	current, err := git.currentBranch()
+	if err != nil {
+		return "", "", err
+	}
+	base := prBase(cfg, current)
+	remote := prRemote(cfg)
+
+	branch := uploadBranch(req.username, req.filename)
+	for n := 2; git.branchExists(branch); n++ {
+		branch = fmt.Sprintf("%s-%d", uploadBranch(req.username, req.filename), n)
+	}
+	err = git.createBranch(branch)
+	if err != nil {
+		return "", "", err
+	}
+	// go back to where we started, so the upload isn't left in the tree for
+	// the next one
+	defer func() {
+		if err := git.checkout(current); err != nil {
+			log.Printf("unable to switch back to %q: %v\n", current, err)
+		}
+	}()
+	err = git.add(req.files...)
+	if err != nil {
+		return "", "", err
+	}
+	commit, err = git.commit(req.message, req.author)
+	if err != nil {
+		return "", "", err
+	}
+	body := fmt.Sprintf("Uploaded to Discord by %s.\n\nFiles:\n- `%s`\n", req.username, strings.Join(req.files, "`\n- `"))
+	// if either step fails the sync will push it and open the pull request
+	// later
+	pending := func(err error) (string, string, error) {
+		if merr := git.markPending(branch, body); merr != nil {
+			log.Printf("unable to mark %q for pushing later: %v\n", branch, merr)
+		}
+		return commit, "", fmt.Errorf("%w: %v", errPushPending, err)
+	}
+	err = retry(func() error { return git.pushBranch(remote, branch) })
+	if err != nil {
+		return pending(err)
+	}
+	prURL, err = forge.OpenPullRequest(&pullRequest{
+		title: req.message,
+		body:  body,
+		head:  branch,
+		base:  base,
+	})
+	if err != nil {
+		return pending(fmt.Errorf("pushed %q but couldn't open a pull request: %v", branch, err))
+	}
+	log.Printf("opened pull request %s\n", prURL)
+	return commit, prURL, nil
+}
+
+// prBase is the branch pull requests should be merged into, current if the
+// config doesn't say.
+func prBase(cfg *pb.PullRequests, current string) string {
+	if cfg.GetBase() != "" {
+		return cfg.GetBase()
+	}
+	return current
+}
+
+// prRemote is where upload branches are pushed.
+func prRemote(cfg *pb.PullRequests) string {
+	if cfg.GetRemote() != "" {
+		return cfg.GetRemote()
+	}
+	return "origin"
+}
+
+// uploadBranch names the branch for an upload: upload/<user>/<map>.
+func uploadBranch(username, filename string) string {
+	clean := func(s string) string {
+		s = branchUnsafe.ReplaceAllString(strings.ToLower(s), "-")
+		s = strings.Trim(s, "-")
+		if s == "" {
+			s = "unknown"
+		}
+		return s
+	}
+	name := strings.TrimSuffix(filename, path.Ext(filename))
+	return fmt.Sprintf("upload/%s/%s", clean(username), clean(name))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+// A pull request that can't be opened after the branch is pushed leaves the
+// upload committed, and the sync opens it once the forge is back.
+func TestPullRequestPending(t *testing.T) {
+	var up atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"html_url": "https://git.example.com/owner/maps/pulls/1"}`)
+	}))
+	defer srv.Close()
+
+	remote := testRemote(t)
+	git := testClone(t, remote)
+	old := config
+	config = &pb.BotConfig{
+		RepoPath:     git.RepoPath,
+		PullRequests: &pb.PullRequests{Forge: pb.Forge_GITEA, ApiUrl: srv.URL, Repo: "owner/maps"},
+	}
+	t.Cleanup(func() { config = old })
+
+	writeRepoFile(t, git.RepoPath, "maps/q2dm2.bsp", "tokay's towers")
+	commit, prURL, err := commitUpload(&commitRequest{
+		message:  "Add q2dm2.bsp",
+		username: "someone",
+		filename: "q2dm2.bsp",
+		files:    []string{"maps/q2dm2.bsp"},
+	})
+	if !errors.Is(err, errPushPending) || commit == "" || prURL != "" {
+		t.Fatalf("commitUpload() = %q, %q, %v, want the commit and errPushPending", commit, prURL, err)
+	}
+	branch := "upload/someone/q2dm2"
+	if got := mustGit(t, remote, "rev-parse", branch); got != commit {
+		t.Errorf("pushed %s = %q, want %q", branch, got, commit)
+	}
+	if branches, _ := git.pendingBranches(); len(branches) != 1 || branches[0] != branch {
+		t.Errorf("pendingBranches() = %q, want %q", branches, branch)
+	}
+
+	// still down, it stays pending
+	pushPendingBranches(nil, git)
+	if branches, _ := git.pendingBranches(); len(branches) != 1 {
+		t.Errorf("pendingBranches() after a failed retry = %q", branches)
+	}
+
+	up.Store(true)
+	pushPendingBranches(nil, git)
+	if branches, _ := git.pendingBranches(); len(branches) != 0 {
+		t.Errorf("pendingBranches() after the pull request opened = %q", branches)
+	}
+}
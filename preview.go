@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/packetflinger/libq2/bsp"
+)
+
+const (
+	previewSize    = 1024 // max width/height of preview images in pixels
+	previewMargin  = 16
+	maxAttachments = 10 // Discord's limit per message
+
+	// lump record sizes
+	faceSize    = 20
+	texinfoSize = 76
+	modelSize   = 48
+
+	// texinfo surface flags for things you can't see
+	surfSky    = 0x4
+	surfNoDraw = 0x80
+)
+
+// preview colors
+var (
+	colorBackground = color.RGBA{0x10, 0x10, 0x14, 0xff}
+	colorSpawn      = color.RGBA{0x2e, 0xcc, 0x71, 0xff}
+	colorWeapon     = color.RGBA{0xe7, 0x4c, 0x3c, 0xff}
+	colorArmor      = color.RGBA{0xf1, 0xc4, 0x0f, 0xff}
+	colorPowerup    = color.RGBA{0x9b, 0x59, 0xb6, 0xff}
+	colorItem       = color.RGBA{0x34, 0x98, 0xdb, 0xff}
+)
+
+type vec3 [3]float32
+
+// previewFace is a polygon from the map, flattened to x/y with the average
+// height kept for ordering and shading.
+type previewFace struct {
+	points [][2]float32
+	height float32
+}
+
+// renderMapPreview draws a top-down view of a map: every upward facing
+// surface of the world filled in (brighter is higher), with spawn points and
+// items drawn on top. Returns a PNG.
+func renderMapPreview(bspfile *bsp.BSPFile) ([]byte, error) {
+	faces, err := previewFaces(bspfile)
+	if err != nil {
+		return nil, err
+	}
+	if len(faces) == 0 {
+		return nil, fmt.Errorf("no visible floor surfaces")
+	}
+
+	// work out the bounds so the map fills the image
+	minX, minY, minZ := float32(math.MaxFloat32), float32(math.MaxFloat32), float32(math.MaxFloat32)
+	maxX, maxY, maxZ := -minX, -minY, -minZ
+	for _, f := range faces {
+		for _, p := range f.points {
+			minX, maxX = min(minX, p[0]), max(maxX, p[0])
+			minY, maxY = min(minY, p[1]), max(maxY, p[1])
+		}
+		minZ, maxZ = min(minZ, f.height), max(maxZ, f.height)
+	}
+	scale := float32(previewSize-2*previewMargin) / max(maxX-minX, maxY-minY, 1)
+	width := int((maxX-minX)*scale) + 2*previewMargin
+	height := int((maxY-minY)*scale) + 2*previewMargin
+	// map +y is north, image +y is down
+	toImage := func(x, y float32) (float32, float32) {
+		return (x-minX)*scale + previewMargin, (maxY-y)*scale + previewMargin
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{colorBackground}, image.Point{}, draw.Src)
+
+	// draw from the bottom up so higher floors cover lower ones
+	sort.Slice(faces, func(i, j int) bool {
+		return faces[i].height < faces[j].height
+	})
+	for _, f := range faces {
+		shade := uint8(60 + 180*(f.height-minZ)/max(maxZ-minZ, 1))
+		c := color.RGBA{shade, shade, shade, 0xff}
+		pts := make([][2]float32, len(f.points))
+		for i, p := range f.points {
+			pts[i][0], pts[i][1] = toImage(p[0], p[1])
+		}
+		fillPolygon(img, pts, c)
+	}
+
+	for _, e := range bspfile.Ents {
+		c, size := entityMarker(e.Class)
+		if size == 0 {
+			continue
+		}
+		origin, ok := parseOrigin(e.Values["origin"])
+		if !ok {
+			continue
+		}
+		x, y := toImage(origin[0], origin[1])
+		fillCircle(img, int(x), int(y), size, c)
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mapPreviewFile renders a preview of a map ready to attach to a message.
+// Failing to render isn't worth stopping an upload over, so errors are just
+// logged and nil is returned.
+func mapPreviewFile(bspfile *bsp.BSPFile, name string) *discordgo.File {
+	data, err := renderMapPreview(bspfile)
+	if err != nil {
+		log.Printf("unable to render preview of %q: %v\n", name, err)
+		return nil
+	}
+	return &discordgo.File{
+		Name:        strings.TrimSuffix(name, path.Ext(name)) + ".png",
+		ContentType: "image/png",
+		Reader:      bytes.NewReader(data),
+	}
+}
+
+// postPreviews will announce a successful upload in the channel it was
+// posted in, with overhead previews of any maps attached. If the upload went
+// to a pull request, prURL links to it.
+func (f *FileUpload) postPreviews(previews []*discordgo.File, prURL string) {
+	if len(previews) == 0 {
+		return
+	}
+	if len(previews) > maxAttachments {
+		previews = previews[:maxAttachments]
+	}
+	content := fmt.Sprintf("`%s` from <@%s> has been added", f.name, f.message.Author.ID)
+	if prURL != "" {
+		content = fmt.Sprintf("`%s` from <@%s> is ready to merge: %s", f.name, f.message.Author.ID, prURL)
+	}
+	_, err := f.session.ChannelMessageSendComplex(f.message.ChannelID, &discordgo.MessageSend{
+		Content: content,
+		Files:   previews,
+	})
+	if err != nil {
+		log.Printf("error posting preview of %q: %v\n", f.name, err)
+	}
+}
+
+// previewFaces pulls the visible, upward facing polygons of the world
+// (model 0) out of the map. Brush entities like doors and triggers aren't
+// included.
+func previewFaces(bspfile *bsp.BSPFile) ([]previewFace, error) {
+	lump := func(i int) []byte {
+		return bspfile.LumpData[i].Data.Data
+	}
+	le := binary.LittleEndian
+	verts := lump(bsp.VerticesLump)
+	edges := lump(bsp.EdgesLump)
+	faceEdges := lump(bsp.FaceEdgeTable)
+	faceData := lump(bsp.FacesLump)
+	planes := lump(bsp.PlanesLump)
+	texinfo := lump(bsp.TextureLump)
+	models := lump(bsp.ModelsLump)
+	if len(models) < modelSize {
+		return nil, fmt.Errorf("no world model")
+	}
+	first := int(int32(le.Uint32(models[40:])))
+	count := int(int32(le.Uint32(models[44:])))
+	if first < 0 || count < 0 {
+		return nil, fmt.Errorf("invalid world model faces")
+	}
+
+	float := func(b []byte, i int) float32 {
+		return math.Float32frombits(le.Uint32(b[i:]))
+	}
+	vertex := func(i int) (vec3, bool) {
+		if i < 0 || (i+1)*12 > len(verts) {
+			return vec3{}, false
+		}
+		return vec3{float(verts, i*12), float(verts, i*12+4), float(verts, i*12+8)}, true
+	}
+
+	var out []previewFace
+	for i := first; i < first+count && (i+1)*faceSize <= len(faceData); i++ {
+		f := faceData[i*faceSize:]
+		plane := int(le.Uint16(f[0:]))
+		side := le.Uint16(f[2:])
+		firstEdge := int(int32(le.Uint32(f[4:])))
+		numEdges := int(le.Uint16(f[8:]))
+		tex := int(le.Uint16(f[10:]))
+		if firstEdge < 0 {
+			continue
+		}
+
+		if (tex+1)*texinfoSize <= len(texinfo) {
+			flags := le.Uint32(texinfo[tex*texinfoSize+32:])
+			if flags&(surfSky|surfNoDraw) != 0 {
+				continue
+			}
+		}
+		if (plane+1)*20 > len(planes) {
+			continue
+		}
+		normalZ := float(planes, plane*20+8)
+		if side != 0 {
+			normalZ = -normalZ
+		}
+		if normalZ < 0.3 { // walls and ceilings
+			continue
+		}
+
+		face := previewFace{}
+		for e := firstEdge; e < firstEdge+numEdges && (e+1)*4 <= len(faceEdges); e++ {
+			edge := int(int32(le.Uint32(faceEdges[e*4:])))
+			var vi int
+			if edge >= 0 {
+				if (edge+1)*4 > len(edges) {
+					break
+				}
+				vi = int(le.Uint16(edges[edge*4:]))
+			} else {
+				edge = -edge
+				if (edge+1)*4 > len(edges) {
+					break
+				}
+				vi = int(le.Uint16(edges[edge*4+2:]))
+			}
+			v, ok := vertex(vi)
+			if !ok {
+				break
+			}
+			face.points = append(face.points, [2]float32{v[0], v[1]})
+			face.height += v[2]
+		}
+		if len(face.points) < 3 {
+			continue
+		}
+		face.height /= float32(len(face.points))
+		out = append(out, face)
+	}
+	return out, nil
+}
+
+// entityMarker decides how to draw an entity on the preview. A size of 0
+// means don't draw it.
+func entityMarker(class string) (color.RGBA, int) {
+	switch {
+	case strings.HasPrefix(class, "info_player_"):
+		return colorSpawn, 6
+	case strings.HasPrefix(class, "weapon_"):
+		return colorWeapon, 5
+	case strings.HasPrefix(class, "item_armor"):
+		return colorArmor, 5
+	case powerups[class]:
+		return colorPowerup, 5
+	case strings.HasPrefix(class, "item_"), strings.HasPrefix(class, "ammo_"):
+		return colorItem, 3
+	}
+	return color.RGBA{}, 0
+}
+
+// parseOrigin reads an entity's "x y z" origin.
+func parseOrigin(s string) (vec3, bool) {
+	var v vec3
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return v, false
+	}
+	for i, f := range fields {
+		n, err := strconv.ParseFloat(f, 32)
+		if err != nil {
+			return v, false
+		}
+		v[i] = float32(n)
+	}
+	return v, true
+}
+
+// fillPolygon fills a convex or concave polygon using the even-odd rule,
+// one scanline at a time.
+func fillPolygon(img *image.RGBA, pts [][2]float32, c color.RGBA) {
+	minY, maxY := pts[0][1], pts[0][1]
+	for _, p := range pts {
+		minY, maxY = min(minY, p[1]), max(maxY, p[1])
+	}
+	var xs []float32
+	for y := int(minY); y <= int(maxY); y++ {
+		fy := float32(y) + 0.5
+		xs = xs[:0]
+		for i := range pts {
+			a, b := pts[i], pts[(i+1)%len(pts)]
+			if (a[1] <= fy && b[1] > fy) || (b[1] <= fy && a[1] > fy) {
+				xs = append(xs, a[0]+(fy-a[1])/(b[1]-a[1])*(b[0]-a[0]))
+			}
+		}
+		sort.Slice(xs, func(i, j int) bool { return xs[i] < xs[j] })
+		for i := 0; i+1 < len(xs); i += 2 {
+			for x := int(xs[i] + 0.5); x < int(xs[i+1]+0.5); x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+// fillCircle draws a filled circle with a dark outline so markers stand out
+// on light floors.
+func fillCircle(img *image.RGBA, cx, cy, r int, c color.RGBA) {
+	outline := color.RGBA{0, 0, 0, 0xff}
+	for y := -r - 1; y <= r+1; y++ {
+		for x := -r - 1; x <= r+1; x++ {
+			d := x*x + y*y
+			switch {
+			case d <= r*r:
+				img.SetRGBA(cx+x, cy+y, c)
+			case d <= (r+1)*(r+1):
+				img.SetRGBA(cx+x, cy+y, outline)
+			}
+		}
+	}
+}
@@ -23,19 +23,248 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type Forge int32
+
+const (
+	Forge_GITHUB Forge = 0
+	Forge_GITEA  Forge = 1
+	Forge_GITLAB Forge = 2
+)
+
+// Enum value maps for Forge.
+var (
+	Forge_name = map[int32]string{
+		0: "GITHUB",
+		1: "GITEA",
+		2: "GITLAB",
+	}
+	Forge_value = map[string]int32{
+		"GITHUB": 0,
+		"GITEA":  1,
+		"GITLAB": 2,
+	}
+)
+
+func (x Forge) Enum() *Forge {
+	p := new(Forge)
+	*p = x
+	return p
+}
+
+func (x Forge) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Forge) Descriptor() protoreflect.EnumDescriptor {
+	return file_config_proto_enumTypes[0].Descriptor()
+}
+
+func (Forge) Type() protoreflect.EnumType {
+	return &file_config_proto_enumTypes[0]
+}
+
+func (x Forge) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Forge.Descriptor instead.
+func (Forge) EnumDescriptor() ([]byte, []int) {
+	return file_config_proto_rawDescGZIP(), []int{0}
+}
+
+type Capability int32
+
+const (
+	Capability_CAPABILITY_NONE Capability = 0
+	Capability_UPLOAD          Capability = 1 // add files to the repo
+	Capability_OVERWRITE       Capability = 2 // replace files already in the repo, approve others doing it
+	Capability_DELETE          Capability = 3 // remove maps from the repo
+	Capability_ADMIN           Capability = 4 // everything
+	Capability_STATUS          Capability = 5 // server status and map queries
+	Capability_MODERATE        Capability = 6 // approve or reject uploads in the review channel
+)
+
+// Enum value maps for Capability.
+var (
+	Capability_name = map[int32]string{
+		0: "CAPABILITY_NONE",
+		1: "UPLOAD",
+		2: "OVERWRITE",
+		3: "DELETE",
+		4: "ADMIN",
+		5: "STATUS",
+		6: "MODERATE",
+	}
+	Capability_value = map[string]int32{
+		"CAPABILITY_NONE": 0,
+		"UPLOAD":          1,
+		"OVERWRITE":       2,
+		"DELETE":          3,
+		"ADMIN":           4,
+		"STATUS":          5,
+		"MODERATE":        6,
+	}
+)
+
+func (x Capability) Enum() *Capability {
+	p := new(Capability)
+	*p = x
+	return p
+}
+
+func (x Capability) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Capability) Descriptor() protoreflect.EnumDescriptor {
+	return file_config_proto_enumTypes[1].Descriptor()
+}
+
+func (Capability) Type() protoreflect.EnumType {
+	return &file_config_proto_enumTypes[1]
+}
+
+func (x Capability) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Capability.Descriptor instead.
+func (Capability) EnumDescriptor() ([]byte, []int) {
+	return file_config_proto_rawDescGZIP(), []int{1}
+}
+
+type OverwritePolicy int32
+
+const (
+	OverwritePolicy_REFUSE  OverwritePolicy = 0 // keep what's in the repo, skip the changed files
+	OverwritePolicy_CONFIRM OverwritePolicy = 1 // ask an admin to approve with a reaction
+	OverwritePolicy_VERSION OverwritePolicy = 2 // add changed maps under a new name (q2dm1_v2.bsp)
+)
+
+// Enum value maps for OverwritePolicy.
+var (
+	OverwritePolicy_name = map[int32]string{
+		0: "REFUSE",
+		1: "CONFIRM",
+		2: "VERSION",
+	}
+	OverwritePolicy_value = map[string]int32{
+		"REFUSE":  0,
+		"CONFIRM": 1,
+		"VERSION": 2,
+	}
+)
+
+func (x OverwritePolicy) Enum() *OverwritePolicy {
+	p := new(OverwritePolicy)
+	*p = x
+	return p
+}
+
+func (x OverwritePolicy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (OverwritePolicy) Descriptor() protoreflect.EnumDescriptor {
+	return file_config_proto_enumTypes[2].Descriptor()
+}
+
+func (OverwritePolicy) Type() protoreflect.EnumType {
+	return &file_config_proto_enumTypes[2]
+}
+
+func (x OverwritePolicy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use OverwritePolicy.Descriptor instead.
+func (OverwritePolicy) EnumDescriptor() ([]byte, []int) {
+	return file_config_proto_rawDescGZIP(), []int{2}
+}
+
+type MissingAssetPolicy int32
+
+const (
+	MissingAssetPolicy_WARN   MissingAssetPolicy = 0 // commit anyway, but tell the uploader what's missing
+	MissingAssetPolicy_REJECT MissingAssetPolicy = 1 // don't commit anything
+)
+
+// Enum value maps for MissingAssetPolicy.
+var (
+	MissingAssetPolicy_name = map[int32]string{
+		0: "WARN",
+		1: "REJECT",
+	}
+	MissingAssetPolicy_value = map[string]int32{
+		"WARN":   0,
+		"REJECT": 1,
+	}
+)
+
+func (x MissingAssetPolicy) Enum() *MissingAssetPolicy {
+	p := new(MissingAssetPolicy)
+	*p = x
+	return p
+}
+
+func (x MissingAssetPolicy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (MissingAssetPolicy) Descriptor() protoreflect.EnumDescriptor {
+	return file_config_proto_enumTypes[3].Descriptor()
+}
+
+func (MissingAssetPolicy) Type() protoreflect.EnumType {
+	return &file_config_proto_enumTypes[3]
+}
+
+func (x MissingAssetPolicy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use MissingAssetPolicy.Descriptor instead.
+func (MissingAssetPolicy) EnumDescriptor() ([]byte, []int) {
+	return file_config_proto_rawDescGZIP(), []int{3}
+}
+
 type BotConfig struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	AuthToken      string   `protobuf:"bytes,1,opt,name=auth_token,json=authToken,proto3" json:"auth_token,omitempty"`
-	StatusChannels []string `protobuf:"bytes,2,rep,name=status_channels,json=statusChannels,proto3" json:"status_channels,omitempty"`
-	MapChannels    []string `protobuf:"bytes,3,rep,name=map_channels,json=mapChannels,proto3" json:"map_channels,omitempty"`
-	Foreground     bool     `protobuf:"varint,4,opt,name=foreground,proto3" json:"foreground,omitempty"`
-	LogFile        string   `protobuf:"bytes,5,opt,name=log_file,json=logFile,proto3" json:"log_file,omitempty"`
-	MapPath        string   `protobuf:"bytes,6,opt,name=map_path,json=mapPath,proto3" json:"map_path,omitempty"`
-	TempPath       string   `protobuf:"bytes,7,opt,name=temp_path,json=tempPath,proto3" json:"temp_path,omitempty"` // will use os.TempDir if empty
-	RepoPath       string   `protobuf:"bytes,8,opt,name=repo_path,json=repoPath,proto3" json:"repo_path,omitempty"`
+	AuthToken          string             `protobuf:"bytes,1,opt,name=auth_token,json=authToken,proto3" json:"auth_token,omitempty"`
+	StatusChannels     []string           `protobuf:"bytes,2,rep,name=status_channels,json=statusChannels,proto3" json:"status_channels,omitempty"`
+	MapChannels        []string           `protobuf:"bytes,3,rep,name=map_channels,json=mapChannels,proto3" json:"map_channels,omitempty"`
+	Foreground         bool               `protobuf:"varint,4,opt,name=foreground,proto3" json:"foreground,omitempty"`
+	LogFile            string             `protobuf:"bytes,5,opt,name=log_file,json=logFile,proto3" json:"log_file,omitempty"`
+	MapPath            string             `protobuf:"bytes,6,opt,name=map_path,json=mapPath,proto3" json:"map_path,omitempty"`
+	TempPath           string             `protobuf:"bytes,7,opt,name=temp_path,json=tempPath,proto3" json:"temp_path,omitempty"` // will use os.TempDir if empty
+	RepoPath           string             `protobuf:"bytes,8,opt,name=repo_path,json=repoPath,proto3" json:"repo_path,omitempty"`
+	SlashCommands      bool               `protobuf:"varint,9,opt,name=slash_commands,json=slashCommands,proto3" json:"slash_commands,omitempty"` // register "/" application commands
+	CommandGuilds      []string           `protobuf:"bytes,10,rep,name=command_guilds,json=commandGuilds,proto3" json:"command_guilds,omitempty"` // register per-guild, global if empty
+	Servers            []*Server          `protobuf:"bytes,11,rep,name=servers,proto3" json:"servers,omitempty"`
+	BoardChannel       string             `protobuf:"bytes,12,opt,name=board_channel,json=boardChannel,proto3" json:"board_channel,omitempty"`                                   // live status board, disabled if empty
+	PollInterval       int32              `protobuf:"varint,13,opt,name=poll_interval,json=pollInterval,proto3" json:"poll_interval,omitempty"`                                  // seconds between server polls, default 60
+	TextStatusChannels []string           `protobuf:"bytes,15,rep,name=text_status_channels,json=textStatusChannels,proto3" json:"text_status_channels,omitempty"`               // plain text status instead of embeds
+	DbPath             string             `protobuf:"bytes,16,opt,name=db_path,json=dbPath,proto3" json:"db_path,omitempty"`                                                     // default $HOME/.config/discordbot/bot.db
+	StatusHistoryDays  int32              `protobuf:"varint,17,opt,name=status_history_days,json=statusHistoryDays,proto3" json:"status_history_days,omitempty"`                 // how long to keep server polls, default 7
+	ValidateChannels   []string           `protobuf:"bytes,18,rep,name=validate_channels,json=validateChannels,proto3" json:"validate_channels,omitempty"`                       // uploads are checked but never committed
+	MissingAssets      MissingAssetPolicy `protobuf:"varint,19,opt,name=missing_assets,json=missingAssets,proto3,enum=proto.MissingAssetPolicy" json:"missing_assets,omitempty"` // what to do with maps missing textures, etc
+	MinDmSpawns        int32              `protobuf:"varint,20,opt,name=min_dm_spawns,json=minDmSpawns,proto3" json:"min_dm_spawns,omitempty"`                                   // warn about maps with fewer, default 4
+	Overwrite          OverwritePolicy    `protobuf:"varint,21,opt,name=overwrite,proto3,enum=proto.OverwritePolicy" json:"overwrite,omitempty"`                                 // uploads that would change files already in the repo
+	Admins             []string           `protobuf:"bytes,22,rep,name=admins,proto3" json:"admins,omitempty"`                                                                   // user IDs allowed to do anything
+	Permissions        []*Permission      `protobuf:"bytes,23,rep,name=permissions,proto3" json:"permissions,omitempty"`
+	ReviewChannel      string             `protobuf:"bytes,24,opt,name=review_channel,json=reviewChannel,proto3" json:"review_channel,omitempty"` // if set, uploads wait here for a moderator
+	StagingPath        string             `protobuf:"bytes,25,opt,name=staging_path,json=stagingPath,proto3" json:"staging_path,omitempty"`       // default $HOME/.config/discordbot/staging
+	PullRequests       *PullRequests      `protobuf:"bytes,26,opt,name=pull_requests,json=pullRequests,proto3" json:"pull_requests,omitempty"`    // if set, open a pull request per upload
+	// If set, uploads are committed with the uploader as the author, "%s" is
+	// replaced with their Discord user ID (ex: "%s@users.discord.invalid").
+	AuthorEmail  string  `protobuf:"bytes,27,opt,name=author_email,json=authorEmail,proto3" json:"author_email,omitempty"`
+	QueueSize    int32   `protobuf:"varint,28,opt,name=queue_size,json=queueSize,proto3" json:"queue_size,omitempty"`          // repo changes that can wait their turn, default 10
+	AdminChannel string  `protobuf:"bytes,29,opt,name=admin_channel,json=adminChannel,proto3" json:"admin_channel,omitempty"`  // where to report problems that need a person
+	SyncInterval int32   `protobuf:"varint,30,opt,name=sync_interval,json=syncInterval,proto3" json:"sync_interval,omitempty"` // seconds between pulls from upstream, default 600, -1 to disable
+	Limits       *Limits `protobuf:"bytes,31,opt,name=limits,proto3" json:"limits,omitempty"`
 }
 
 func (x *BotConfig) Reset() {
@@ -126,11 +355,517 @@ func (x *BotConfig) GetRepoPath() string {
 	return ""
 }
 
+func (x *BotConfig) GetSlashCommands() bool {
+	if x != nil {
+		return x.SlashCommands
+	}
+	return false
+}
+
+func (x *BotConfig) GetCommandGuilds() []string {
+	if x != nil {
+		return x.CommandGuilds
+	}
+	return nil
+}
+
+func (x *BotConfig) GetServers() []*Server {
+	if x != nil {
+		return x.Servers
+	}
+	return nil
+}
+
+func (x *BotConfig) GetBoardChannel() string {
+	if x != nil {
+		return x.BoardChannel
+	}
+	return ""
+}
+
+func (x *BotConfig) GetPollInterval() int32 {
+	if x != nil {
+		return x.PollInterval
+	}
+	return 0
+}
+
+func (x *BotConfig) GetTextStatusChannels() []string {
+	if x != nil {
+		return x.TextStatusChannels
+	}
+	return nil
+}
+
+func (x *BotConfig) GetDbPath() string {
+	if x != nil {
+		return x.DbPath
+	}
+	return ""
+}
+
+func (x *BotConfig) GetStatusHistoryDays() int32 {
+	if x != nil {
+		return x.StatusHistoryDays
+	}
+	return 0
+}
+
+func (x *BotConfig) GetValidateChannels() []string {
+	if x != nil {
+		return x.ValidateChannels
+	}
+	return nil
+}
+
+func (x *BotConfig) GetMissingAssets() MissingAssetPolicy {
+	if x != nil {
+		return x.MissingAssets
+	}
+	return MissingAssetPolicy_WARN
+}
+
+func (x *BotConfig) GetMinDmSpawns() int32 {
+	if x != nil {
+		return x.MinDmSpawns
+	}
+	return 0
+}
+
+func (x *BotConfig) GetOverwrite() OverwritePolicy {
+	if x != nil {
+		return x.Overwrite
+	}
+	return OverwritePolicy_REFUSE
+}
+
+func (x *BotConfig) GetAdmins() []string {
+	if x != nil {
+		return x.Admins
+	}
+	return nil
+}
+
+func (x *BotConfig) GetPermissions() []*Permission {
+	if x != nil {
+		return x.Permissions
+	}
+	return nil
+}
+
+func (x *BotConfig) GetReviewChannel() string {
+	if x != nil {
+		return x.ReviewChannel
+	}
+	return ""
+}
+
+func (x *BotConfig) GetStagingPath() string {
+	if x != nil {
+		return x.StagingPath
+	}
+	return ""
+}
+
+func (x *BotConfig) GetPullRequests() *PullRequests {
+	if x != nil {
+		return x.PullRequests
+	}
+	return nil
+}
+
+func (x *BotConfig) GetAuthorEmail() string {
+	if x != nil {
+		return x.AuthorEmail
+	}
+	return ""
+}
+
+func (x *BotConfig) GetQueueSize() int32 {
+	if x != nil {
+		return x.QueueSize
+	}
+	return 0
+}
+
+func (x *BotConfig) GetAdminChannel() string {
+	if x != nil {
+		return x.AdminChannel
+	}
+	return ""
+}
+
+func (x *BotConfig) GetSyncInterval() int32 {
+	if x != nil {
+		return x.SyncInterval
+	}
+	return 0
+}
+
+func (x *BotConfig) GetLimits() *Limits {
+	if x != nil {
+		return x.Limits
+	}
+	return nil
+}
+
+// How big an upload can be. Anything unset (or 0) gets the default.
+type Limits struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	MaxAttachmentBytes   int64 `protobuf:"varint,1,opt,name=max_attachment_bytes,json=maxAttachmentBytes,proto3" json:"max_attachment_bytes,omitempty"`       // the download itself, default 100MB
+	MaxUncompressedBytes int64 `protobuf:"varint,2,opt,name=max_uncompressed_bytes,json=maxUncompressedBytes,proto3" json:"max_uncompressed_bytes,omitempty"` // everything in an archive, default 512MB
+	MaxEntries           int32 `protobuf:"varint,3,opt,name=max_entries,json=maxEntries,proto3" json:"max_entries,omitempty"`                                 // files in an archive, default 5000
+	MaxCompressionRatio  int32 `protobuf:"varint,4,opt,name=max_compression_ratio,json=maxCompressionRatio,proto3" json:"max_compression_ratio,omitempty"`    // uncompressed/compressed for each file, default 100
+	MaxFileBytes         int64 `protobuf:"varint,5,opt,name=max_file_bytes,json=maxFileBytes,proto3" json:"max_file_bytes,omitempty"`                         // any one file in an archive, default 256MB
+}
+
+func (x *Limits) Reset() {
+	*x = Limits{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_config_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Limits) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Limits) ProtoMessage() {}
+
+func (x *Limits) ProtoReflect() protoreflect.Message {
+	mi := &file_config_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Limits.ProtoReflect.Descriptor instead.
+func (*Limits) Descriptor() ([]byte, []int) {
+	return file_config_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Limits) GetMaxAttachmentBytes() int64 {
+	if x != nil {
+		return x.MaxAttachmentBytes
+	}
+	return 0
+}
+
+func (x *Limits) GetMaxUncompressedBytes() int64 {
+	if x != nil {
+		return x.MaxUncompressedBytes
+	}
+	return 0
+}
+
+func (x *Limits) GetMaxEntries() int32 {
+	if x != nil {
+		return x.MaxEntries
+	}
+	return 0
+}
+
+func (x *Limits) GetMaxCompressionRatio() int32 {
+	if x != nil {
+		return x.MaxCompressionRatio
+	}
+	return 0
+}
+
+func (x *Limits) GetMaxFileBytes() int64 {
+	if x != nil {
+		return x.MaxFileBytes
+	}
+	return 0
+}
+
+// Instead of pushing uploads to the checked out branch, push each one to its
+// own branch (upload/<user>/<map>) and open a pull request for it.
+type PullRequests struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Forge  Forge  `protobuf:"varint,1,opt,name=forge,proto3,enum=proto.Forge" json:"forge,omitempty"`
+	ApiUrl string `protobuf:"bytes,2,opt,name=api_url,json=apiUrl,proto3" json:"api_url,omitempty"` // default is the public GitHub/GitLab API, required for Gitea
+	Token  string `protobuf:"bytes,3,opt,name=token,proto3" json:"token,omitempty"`
+	Repo   string `protobuf:"bytes,4,opt,name=repo,proto3" json:"repo,omitempty"`     // "owner/name", or the project path for GitLab
+	Base   string `protobuf:"bytes,5,opt,name=base,proto3" json:"base,omitempty"`     // branch to merge into, default is the checked out branch
+	Remote string `protobuf:"bytes,6,opt,name=remote,proto3" json:"remote,omitempty"` // default "origin"
+}
+
+func (x *PullRequests) Reset() {
+	*x = PullRequests{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_config_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PullRequests) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PullRequests) ProtoMessage() {}
+
+func (x *PullRequests) ProtoReflect() protoreflect.Message {
+	mi := &file_config_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PullRequests.ProtoReflect.Descriptor instead.
+func (*PullRequests) Descriptor() ([]byte, []int) {
+	return file_config_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PullRequests) GetForge() Forge {
+	if x != nil {
+		return x.Forge
+	}
+	return Forge_GITHUB
+}
+
+func (x *PullRequests) GetApiUrl() string {
+	if x != nil {
+		return x.ApiUrl
+	}
+	return ""
+}
+
+func (x *PullRequests) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *PullRequests) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *PullRequests) GetBase() string {
+	if x != nil {
+		return x.Base
+	}
+	return ""
+}
+
+func (x *PullRequests) GetRemote() string {
+	if x != nil {
+		return x.Remote
+	}
+	return ""
+}
+
+// Who is allowed to do something. A capability without any permissions
+// configured is open to everyone for UPLOAD and STATUS, and only to admins
+// for the rest. Users or roles given ADMIN can do everything.
+type Permission struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Capability Capability `protobuf:"varint,1,opt,name=capability,proto3,enum=proto.Capability" json:"capability,omitempty"`
+	Roles      []string   `protobuf:"bytes,2,rep,name=roles,proto3" json:"roles,omitempty"` // discord role IDs
+	Users      []string   `protobuf:"bytes,3,rep,name=users,proto3" json:"users,omitempty"` // discord user IDs
+}
+
+func (x *Permission) Reset() {
+	*x = Permission{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_config_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Permission) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Permission) ProtoMessage() {}
+
+func (x *Permission) ProtoReflect() protoreflect.Message {
+	mi := &file_config_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Permission.ProtoReflect.Descriptor instead.
+func (*Permission) Descriptor() ([]byte, []int) {
+	return file_config_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Permission) GetCapability() Capability {
+	if x != nil {
+		return x.Capability
+	}
+	return Capability_CAPABILITY_NONE
+}
+
+func (x *Permission) GetRoles() []string {
+	if x != nil {
+		return x.Roles
+	}
+	return nil
+}
+
+func (x *Permission) GetUsers() []string {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
+// A Quake 2 server we know about, so users can refer to it by a short name
+// instead of host:port.
+type Server struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Alias       string `protobuf:"bytes,1,opt,name=alias,proto3" json:"alias,omitempty"`     // ex: "tdm1"
+	Address     string `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"` // host:port
+	Description string `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	Gamedir     string `protobuf:"bytes,4,opt,name=gamedir,proto3" json:"gamedir,omitempty"`
+	Channel     string `protobuf:"bytes,5,opt,name=channel,proto3" json:"channel,omitempty"` // only usable in this channel, any status channel if empty
+	// Population alerts: when the player count reaches alert_players, or an
+	// OpenTDM match goes live (if alert_match_start), a message is posted to
+	// each of the alert_channels. No more than one alert per server is sent
+	// within alert_cooldown seconds.
+	AlertChannels   []string `protobuf:"bytes,6,rep,name=alert_channels,json=alertChannels,proto3" json:"alert_channels,omitempty"`
+	AlertPlayers    int32    `protobuf:"varint,7,opt,name=alert_players,json=alertPlayers,proto3" json:"alert_players,omitempty"` // 0 disables player count alerts
+	AlertMatchStart bool     `protobuf:"varint,8,opt,name=alert_match_start,json=alertMatchStart,proto3" json:"alert_match_start,omitempty"`
+	AlertCooldown   int32    `protobuf:"varint,9,opt,name=alert_cooldown,json=alertCooldown,proto3" json:"alert_cooldown,omitempty"` // default 900
+}
+
+func (x *Server) Reset() {
+	*x = Server{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_config_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Server) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Server) ProtoMessage() {}
+
+func (x *Server) ProtoReflect() protoreflect.Message {
+	mi := &file_config_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Server.ProtoReflect.Descriptor instead.
+func (*Server) Descriptor() ([]byte, []int) {
+	return file_config_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Server) GetAlias() string {
+	if x != nil {
+		return x.Alias
+	}
+	return ""
+}
+
+func (x *Server) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *Server) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Server) GetGamedir() string {
+	if x != nil {
+		return x.Gamedir
+	}
+	return ""
+}
+
+func (x *Server) GetChannel() string {
+	if x != nil {
+		return x.Channel
+	}
+	return ""
+}
+
+func (x *Server) GetAlertChannels() []string {
+	if x != nil {
+		return x.AlertChannels
+	}
+	return nil
+}
+
+func (x *Server) GetAlertPlayers() int32 {
+	if x != nil {
+		return x.AlertPlayers
+	}
+	return 0
+}
+
+func (x *Server) GetAlertMatchStart() bool {
+	if x != nil {
+		return x.AlertMatchStart
+	}
+	return false
+}
+
+func (x *Server) GetAlertCooldown() int32 {
+	if x != nil {
+		return x.AlertCooldown
+	}
+	return 0
+}
+
 var File_config_proto protoreflect.FileDescriptor
 
 var file_config_proto_rawDesc = []byte{
 	0x0a, 0x0c, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x05,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x86, 0x02, 0x0a, 0x09, 0x42, 0x6f, 0x74, 0x43, 0x6f, 0x6e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xa1, 0x09, 0x0a, 0x09, 0x42, 0x6f, 0x74, 0x43, 0x6f, 0x6e,
 	0x66, 0x69, 0x67, 0x12, 0x1d, 0x0a, 0x0a, 0x61, 0x75, 0x74, 0x68, 0x5f, 0x74, 0x6f, 0x6b, 0x65,
 	0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x61, 0x75, 0x74, 0x68, 0x54, 0x6f, 0x6b,
 	0x65, 0x6e, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x5f, 0x63, 0x68, 0x61,
@@ -146,10 +881,135 @@ var file_config_proto_rawDesc = []byte{
 	0x50, 0x61, 0x74, 0x68, 0x12, 0x1b, 0x0a, 0x09, 0x74, 0x65, 0x6d, 0x70, 0x5f, 0x70, 0x61, 0x74,
 	0x68, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x74, 0x65, 0x6d, 0x70, 0x50, 0x61, 0x74,
 	0x68, 0x12, 0x1b, 0x0a, 0x09, 0x72, 0x65, 0x70, 0x6f, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x08,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x70, 0x6f, 0x50, 0x61, 0x74, 0x68, 0x42, 0x26,
-	0x5a, 0x24, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x70, 0x61, 0x63,
-	0x6b, 0x65, 0x74, 0x66, 0x6c, 0x69, 0x6e, 0x67, 0x65, 0x72, 0x2f, 0x6c, 0x69, 0x62, 0x71, 0x32,
-	0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x70, 0x6f, 0x50, 0x61, 0x74, 0x68, 0x12, 0x25,
+	0x0a, 0x0e, 0x73, 0x6c, 0x61, 0x73, 0x68, 0x5f, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x73,
+	0x18, 0x09, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0d, 0x73, 0x6c, 0x61, 0x73, 0x68, 0x43, 0x6f, 0x6d,
+	0x6d, 0x61, 0x6e, 0x64, 0x73, 0x12, 0x25, 0x0a, 0x0e, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64,
+	0x5f, 0x67, 0x75, 0x69, 0x6c, 0x64, 0x73, 0x18, 0x0a, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0d, 0x63,
+	0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x47, 0x75, 0x69, 0x6c, 0x64, 0x73, 0x12, 0x27, 0x0a, 0x07,
+	0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x73, 0x18, 0x0b, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0d, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x52, 0x07, 0x73, 0x65,
+	0x72, 0x76, 0x65, 0x72, 0x73, 0x12, 0x23, 0x0a, 0x0d, 0x62, 0x6f, 0x61, 0x72, 0x64, 0x5f, 0x63,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x62, 0x6f,
+	0x61, 0x72, 0x64, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x12, 0x23, 0x0a, 0x0d, 0x70, 0x6f,
+	0x6c, 0x6c, 0x5f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x18, 0x0d, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x0c, 0x70, 0x6f, 0x6c, 0x6c, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x12,
+	0x30, 0x0a, 0x14, 0x74, 0x65, 0x78, 0x74, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x5f, 0x63,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73, 0x18, 0x0f, 0x20, 0x03, 0x28, 0x09, 0x52, 0x12, 0x74,
+	0x65, 0x78, 0x74, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c,
+	0x73, 0x12, 0x17, 0x0a, 0x07, 0x64, 0x62, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x10, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x06, 0x64, 0x62, 0x50, 0x61, 0x74, 0x68, 0x12, 0x2e, 0x0a, 0x13, 0x73, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x5f, 0x68, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x5f, 0x64, 0x61, 0x79,
+	0x73, 0x18, 0x11, 0x20, 0x01, 0x28, 0x05, 0x52, 0x11, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x48,
+	0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x44, 0x61, 0x79, 0x73, 0x12, 0x2b, 0x0a, 0x11, 0x76, 0x61,
+	0x6c, 0x69, 0x64, 0x61, 0x74, 0x65, 0x5f, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73, 0x18,
+	0x12, 0x20, 0x03, 0x28, 0x09, 0x52, 0x10, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74, 0x65, 0x43,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73, 0x12, 0x40, 0x0a, 0x0e, 0x6d, 0x69, 0x73, 0x73, 0x69,
+	0x6e, 0x67, 0x5f, 0x61, 0x73, 0x73, 0x65, 0x74, 0x73, 0x18, 0x13, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4d, 0x69, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x41,
+	0x73, 0x73, 0x65, 0x74, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x0d, 0x6d, 0x69, 0x73, 0x73,
+	0x69, 0x6e, 0x67, 0x41, 0x73, 0x73, 0x65, 0x74, 0x73, 0x12, 0x22, 0x0a, 0x0d, 0x6d, 0x69, 0x6e,
+	0x5f, 0x64, 0x6d, 0x5f, 0x73, 0x70, 0x61, 0x77, 0x6e, 0x73, 0x18, 0x14, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x0b, 0x6d, 0x69, 0x6e, 0x44, 0x6d, 0x53, 0x70, 0x61, 0x77, 0x6e, 0x73, 0x12, 0x34, 0x0a,
+	0x09, 0x6f, 0x76, 0x65, 0x72, 0x77, 0x72, 0x69, 0x74, 0x65, 0x18, 0x15, 0x20, 0x01, 0x28, 0x0e,
+	0x32, 0x16, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4f, 0x76, 0x65, 0x72, 0x77, 0x72, 0x69,
+	0x74, 0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x09, 0x6f, 0x76, 0x65, 0x72, 0x77, 0x72,
+	0x69, 0x74, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x61, 0x64, 0x6d, 0x69, 0x6e, 0x73, 0x18, 0x16, 0x20,
+	0x03, 0x28, 0x09, 0x52, 0x06, 0x61, 0x64, 0x6d, 0x69, 0x6e, 0x73, 0x12, 0x33, 0x0a, 0x0b, 0x70,
+	0x65, 0x72, 0x6d, 0x69, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x17, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x11, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x50, 0x65, 0x72, 0x6d, 0x69, 0x73, 0x73,
+	0x69, 0x6f, 0x6e, 0x52, 0x0b, 0x70, 0x65, 0x72, 0x6d, 0x69, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73,
+	0x12, 0x25, 0x0a, 0x0e, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x5f, 0x63, 0x68, 0x61, 0x6e, 0x6e,
+	0x65, 0x6c, 0x18, 0x18, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77,
+	0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x12, 0x21, 0x0a, 0x0c, 0x73, 0x74, 0x61, 0x67, 0x69,
+	0x6e, 0x67, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x19, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x73,
+	0x74, 0x61, 0x67, 0x69, 0x6e, 0x67, 0x50, 0x61, 0x74, 0x68, 0x12, 0x38, 0x0a, 0x0d, 0x70, 0x75,
+	0x6c, 0x6c, 0x5f, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x73, 0x18, 0x1a, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x13, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x50, 0x75, 0x6c, 0x6c, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x73, 0x52, 0x0c, 0x70, 0x75, 0x6c, 0x6c, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x73, 0x12, 0x21, 0x0a, 0x0c, 0x61, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x5f, 0x65,
+	0x6d, 0x61, 0x69, 0x6c, 0x18, 0x1b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x61, 0x75, 0x74, 0x68,
+	0x6f, 0x72, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x1d, 0x0a, 0x0a, 0x71, 0x75, 0x65, 0x75, 0x65,
+	0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x1c, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x71, 0x75, 0x65,
+	0x75, 0x65, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x61, 0x64, 0x6d, 0x69, 0x6e, 0x5f,
+	0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x18, 0x1d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x61,
+	0x64, 0x6d, 0x69, 0x6e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x12, 0x23, 0x0a, 0x0d, 0x73,
+	0x79, 0x6e, 0x63, 0x5f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x18, 0x1e, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x0c, 0x73, 0x79, 0x6e, 0x63, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c,
+	0x12, 0x25, 0x0a, 0x06, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x18, 0x1f, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x0d, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x52,
+	0x06, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x4a, 0x04, 0x08, 0x0e, 0x10, 0x0f, 0x52, 0x0a, 0x73,
+	0x74, 0x61, 0x74, 0x65, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x22, 0xeb, 0x01, 0x0a, 0x06, 0x4c, 0x69,
+	0x6d, 0x69, 0x74, 0x73, 0x12, 0x30, 0x0a, 0x14, 0x6d, 0x61, 0x78, 0x5f, 0x61, 0x74, 0x74, 0x61,
+	0x63, 0x68, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x12, 0x6d, 0x61, 0x78, 0x41, 0x74, 0x74, 0x61, 0x63, 0x68, 0x6d, 0x65, 0x6e,
+	0x74, 0x42, 0x79, 0x74, 0x65, 0x73, 0x12, 0x34, 0x0a, 0x16, 0x6d, 0x61, 0x78, 0x5f, 0x75, 0x6e,
+	0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x65, 0x64, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x14, 0x6d, 0x61, 0x78, 0x55, 0x6e, 0x63, 0x6f, 0x6d,
+	0x70, 0x72, 0x65, 0x73, 0x73, 0x65, 0x64, 0x42, 0x79, 0x74, 0x65, 0x73, 0x12, 0x1f, 0x0a, 0x0b,
+	0x6d, 0x61, 0x78, 0x5f, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x0a, 0x6d, 0x61, 0x78, 0x45, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x12, 0x32, 0x0a,
+	0x15, 0x6d, 0x61, 0x78, 0x5f, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e,
+	0x5f, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x13, 0x6d, 0x61,
+	0x78, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x61, 0x74, 0x69,
+	0x6f, 0x12, 0x24, 0x0a, 0x0e, 0x6d, 0x61, 0x78, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x62, 0x79,
+	0x74, 0x65, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x6d, 0x61, 0x78, 0x46, 0x69,
+	0x6c, 0x65, 0x42, 0x79, 0x74, 0x65, 0x73, 0x22, 0xa1, 0x01, 0x0a, 0x0c, 0x50, 0x75, 0x6c, 0x6c,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x73, 0x12, 0x22, 0x0a, 0x05, 0x66, 0x6f, 0x72, 0x67,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0c, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
+	0x46, 0x6f, 0x72, 0x67, 0x65, 0x52, 0x05, 0x66, 0x6f, 0x72, 0x67, 0x65, 0x12, 0x17, 0x0a, 0x07,
+	0x61, 0x70, 0x69, 0x5f, 0x75, 0x72, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x61,
+	0x70, 0x69, 0x55, 0x72, 0x6c, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x72,
+	0x65, 0x70, 0x6f, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x72, 0x65, 0x70, 0x6f, 0x12,
+	0x12, 0x0a, 0x04, 0x62, 0x61, 0x73, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x62,
+	0x61, 0x73, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x22, 0x6b, 0x0a, 0x0a, 0x50,
+	0x65, 0x72, 0x6d, 0x69, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x31, 0x0a, 0x0a, 0x63, 0x61, 0x70,
+	0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x11, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x79,
+	0x52, 0x0a, 0x63, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x79, 0x12, 0x14, 0x0a, 0x05,
+	0x72, 0x6f, 0x6c, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x05, 0x72, 0x6f, 0x6c,
+	0x65, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x75, 0x73, 0x65, 0x72, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x05, 0x75, 0x73, 0x65, 0x72, 0x73, 0x22, 0xad, 0x02, 0x0a, 0x06, 0x53, 0x65, 0x72,
+	0x76, 0x65, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x61, 0x6c, 0x69, 0x61, 0x73, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x61, 0x6c, 0x69, 0x61, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x64, 0x64,
+	0x72, 0x65, 0x73, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x61, 0x64, 0x64, 0x72,
+	0x65, 0x73, 0x73, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69,
+	0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69,
+	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x67, 0x61, 0x6d, 0x65, 0x64, 0x69, 0x72,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x67, 0x61, 0x6d, 0x65, 0x64, 0x69, 0x72, 0x12,
+	0x18, 0x0a, 0x07, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x07, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x12, 0x25, 0x0a, 0x0e, 0x61, 0x6c, 0x65,
+	0x72, 0x74, 0x5f, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x0d, 0x61, 0x6c, 0x65, 0x72, 0x74, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73,
+	0x12, 0x23, 0x0a, 0x0d, 0x61, 0x6c, 0x65, 0x72, 0x74, 0x5f, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72,
+	0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c, 0x61, 0x6c, 0x65, 0x72, 0x74, 0x50, 0x6c,
+	0x61, 0x79, 0x65, 0x72, 0x73, 0x12, 0x2a, 0x0a, 0x11, 0x61, 0x6c, 0x65, 0x72, 0x74, 0x5f, 0x6d,
+	0x61, 0x74, 0x63, 0x68, 0x5f, 0x73, 0x74, 0x61, 0x72, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x0f, 0x61, 0x6c, 0x65, 0x72, 0x74, 0x4d, 0x61, 0x74, 0x63, 0x68, 0x53, 0x74, 0x61, 0x72,
+	0x74, 0x12, 0x25, 0x0a, 0x0e, 0x61, 0x6c, 0x65, 0x72, 0x74, 0x5f, 0x63, 0x6f, 0x6f, 0x6c, 0x64,
+	0x6f, 0x77, 0x6e, 0x18, 0x09, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0d, 0x61, 0x6c, 0x65, 0x72, 0x74,
+	0x43, 0x6f, 0x6f, 0x6c, 0x64, 0x6f, 0x77, 0x6e, 0x2a, 0x2a, 0x0a, 0x05, 0x46, 0x6f, 0x72, 0x67,
+	0x65, 0x12, 0x0a, 0x0a, 0x06, 0x47, 0x49, 0x54, 0x48, 0x55, 0x42, 0x10, 0x00, 0x12, 0x09, 0x0a,
+	0x05, 0x47, 0x49, 0x54, 0x45, 0x41, 0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x47, 0x49, 0x54, 0x4c,
+	0x41, 0x42, 0x10, 0x02, 0x2a, 0x6d, 0x0a, 0x0a, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69,
+	0x74, 0x79, 0x12, 0x13, 0x0a, 0x0f, 0x43, 0x41, 0x50, 0x41, 0x42, 0x49, 0x4c, 0x49, 0x54, 0x59,
+	0x5f, 0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x55, 0x50, 0x4c, 0x4f, 0x41,
+	0x44, 0x10, 0x01, 0x12, 0x0d, 0x0a, 0x09, 0x4f, 0x56, 0x45, 0x52, 0x57, 0x52, 0x49, 0x54, 0x45,
+	0x10, 0x02, 0x12, 0x0a, 0x0a, 0x06, 0x44, 0x45, 0x4c, 0x45, 0x54, 0x45, 0x10, 0x03, 0x12, 0x09,
+	0x0a, 0x05, 0x41, 0x44, 0x4d, 0x49, 0x4e, 0x10, 0x04, 0x12, 0x0a, 0x0a, 0x06, 0x53, 0x54, 0x41,
+	0x54, 0x55, 0x53, 0x10, 0x05, 0x12, 0x0c, 0x0a, 0x08, 0x4d, 0x4f, 0x44, 0x45, 0x52, 0x41, 0x54,
+	0x45, 0x10, 0x06, 0x2a, 0x37, 0x0a, 0x0f, 0x4f, 0x76, 0x65, 0x72, 0x77, 0x72, 0x69, 0x74, 0x65,
+	0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x0a, 0x0a, 0x06, 0x52, 0x45, 0x46, 0x55, 0x53, 0x45,
+	0x10, 0x00, 0x12, 0x0b, 0x0a, 0x07, 0x43, 0x4f, 0x4e, 0x46, 0x49, 0x52, 0x4d, 0x10, 0x01, 0x12,
+	0x0b, 0x0a, 0x07, 0x56, 0x45, 0x52, 0x53, 0x49, 0x4f, 0x4e, 0x10, 0x02, 0x2a, 0x2a, 0x0a, 0x12,
+	0x4d, 0x69, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x41, 0x73, 0x73, 0x65, 0x74, 0x50, 0x6f, 0x6c, 0x69,
+	0x63, 0x79, 0x12, 0x08, 0x0a, 0x04, 0x57, 0x41, 0x52, 0x4e, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06,
+	0x52, 0x45, 0x4a, 0x45, 0x43, 0x54, 0x10, 0x01, 0x42, 0x26, 0x5a, 0x24, 0x67, 0x69, 0x74, 0x68,
+	0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x66, 0x6c, 0x69,
+	0x6e, 0x67, 0x65, 0x72, 0x2f, 0x6c, 0x69, 0x62, 0x71, 0x32, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -164,16 +1024,33 @@ func file_config_proto_rawDescGZIP() []byte {
 	return file_config_proto_rawDescData
 }
 
-var file_config_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_config_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_config_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
 var file_config_proto_goTypes = []interface{}{
-	(*BotConfig)(nil), // 0: proto.BotConfig
+	(Forge)(0),              // 0: proto.Forge
+	(Capability)(0),         // 1: proto.Capability
+	(OverwritePolicy)(0),    // 2: proto.OverwritePolicy
+	(MissingAssetPolicy)(0), // 3: proto.MissingAssetPolicy
+	(*BotConfig)(nil),       // 4: proto.BotConfig
+	(*Limits)(nil),          // 5: proto.Limits
+	(*PullRequests)(nil),    // 6: proto.PullRequests
+	(*Permission)(nil),      // 7: proto.Permission
+	(*Server)(nil),          // 8: proto.Server
 }
 var file_config_proto_depIdxs = []int32{
-	0, // [0:0] is the sub-list for method output_type
-	0, // [0:0] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	8, // 0: proto.BotConfig.servers:type_name -> proto.Server
+	3, // 1: proto.BotConfig.missing_assets:type_name -> proto.MissingAssetPolicy
+	2, // 2: proto.BotConfig.overwrite:type_name -> proto.OverwritePolicy
+	7, // 3: proto.BotConfig.permissions:type_name -> proto.Permission
+	6, // 4: proto.BotConfig.pull_requests:type_name -> proto.PullRequests
+	5, // 5: proto.BotConfig.limits:type_name -> proto.Limits
+	0, // 6: proto.PullRequests.forge:type_name -> proto.Forge
+	1, // 7: proto.Permission.capability:type_name -> proto.Capability
+	8, // [8:8] is the sub-list for method output_type
+	8, // [8:8] is the sub-list for method input_type
+	8, // [8:8] is the sub-list for extension type_name
+	8, // [8:8] is the sub-list for extension extendee
+	0, // [0:8] is the sub-list for field type_name
 }
 
 func init() { file_config_proto_init() }
@@ -194,19 +1071,68 @@ func file_config_proto_init() {
 				return nil
 			}
 		}
+		file_config_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Limits); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_config_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PullRequests); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_config_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Permission); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_config_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Server); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_config_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   1,
+			NumEnums:      4,
+			NumMessages:   5,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_config_proto_goTypes,
 		DependencyIndexes: file_config_proto_depIdxs,
+		EnumInfos:         file_config_proto_enumTypes,
 		MessageInfos:      file_config_proto_msgTypes,
 	}.Build()
 	File_config_proto = out.File
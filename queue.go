@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultQueueSize = 10
+
+// A repoJob is anything that changes the repo: writing an upload, committing
+// an approved one, deleting a map. Jobs are run one at a time so they can't
+// commit each other's files.
+type repoJob struct {
+	description string // for queue status, ex: "q2dm1.bsp from someone"
+	run         func()
+	started     time.Time
+}
+
+// repoQueue runs jobs in the order they were added, on a single worker.
+type repoQueue struct {
+	jobs chan *repoJob
+
+	mu      sync.Mutex
+	waiting []*repoJob
+	current *repoJob
+}
+
+// the queue everything that touches the repo goes through, started in main()
+var repoJobs *repoQueue
+
+// newRepoQueue creates a queue that holds up to size jobs waiting to run,
+// and starts its worker.
+func newRepoQueue(size int) *repoQueue {
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	q := &repoQueue{jobs: make(chan *repoJob, size)}
+	go q.work()
+	return q
+}
+
+// add puts a job on the end of the queue and returns how many jobs are ahead
+// of it. If the queue is full the job isn't added and ok is false, the
+// caller should ask whoever wanted it to try again later.
+func (q *repoQueue) add(job *repoJob) (ahead int, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ahead = len(q.waiting)
+	if q.current != nil {
+		ahead++
+	}
+	select {
+	case q.jobs <- job:
+		q.waiting = append(q.waiting, job)
+		return ahead, true
+	default:
+		log.Printf("repo queue full, dropping %q\n", job.description)
+		return ahead, false
+	}
+}
+
+// work runs jobs as they arrive, forever.
+func (q *repoQueue) work() {
+	for job := range q.jobs {
+		q.mu.Lock()
+		q.waiting = q.waiting[1:]
+		q.current = job
+		job.started = time.Now()
+		q.mu.Unlock()
+
+		q.runJob(job)
+
+		q.mu.Lock()
+		q.current = nil
+		q.mu.Unlock()
+	}
+}
+
+// runJob runs a single job. A panic only loses that job, not the worker.
+func (q *repoQueue) runJob(job *repoJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("repo job %q panicked: %v\n", job.description, r)
+		}
+	}()
+	job.run()
+	log.Printf("repo job %q done in %v\n", job.description, time.Since(job.started).Round(time.Millisecond))
+}
+
+// status describes what the queue is doing.
+func (q *repoQueue) status() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.current == nil && len(q.waiting) == 0 {
+		return "Nothing is waiting, uploads are being handled right away."
+	}
+	var out strings.Builder
+	if q.current != nil {
+		fmt.Fprintf(&out, "Working on %s (started <t:%d:R>)\n", q.current.description, q.current.started.Unix())
+	}
+	if len(q.waiting) > 0 {
+		fmt.Fprintf(&out, "%d waiting (room for %d more):\n", len(q.waiting), cap(q.jobs)-len(q.waiting))
+		for i, job := range q.waiting {
+			fmt.Fprintf(&out, "%d. %s\n", i+1, job.description)
+		}
+	}
+	return out.String()
+}
+
+// cmdMapsQueue will reply with what the repo queue is doing.
+func cmdMapsQueue(r *commandRequest) {
+	r.reply(repoJobs.status())
+}
+
+// queuedMessage tells someone where their job is in the queue, or "" if it's
+// being started right away.
+func queuedMessage(what string, ahead int) string {
+	if ahead == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s is #%d in the queue, it'll be handled after the %d ahead of it.", what, ahead+1, ahead)
+}
+
+// queueFullMessage tells someone their job couldn't be queued.
+func queueFullMessage(what string) string {
+	return fmt.Sprintf("Sorry, I'm too busy to take %s right now. Please try again in a few minutes.", what)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+// how many of an upload's files are listed in its review message
+const maxReviewFiles = 20
+
+// Only one review is acted on at a time, so two moderators reacting at once
+// can't both commit the same upload.
+var reviewMu sync.Mutex
+
+// submitForReview posts a staged upload in the review channel for a
+// moderator to approve or reject, and remembers it until they do.
+func (f *FileUpload) submitForReview(pm *discordgo.Channel, files []string, size int64, report string, previews []*discordgo.File) {
+	header := fmt.Sprintf("<@%s> uploaded `%s`, %d files (%d bytes):\n```\n%s\n```",
+		f.message.Author.ID, f.name, len(files), size, listNames(files, maxReviewFiles))
+	footer := fmt.Sprintf("\nReact %s to commit it or %s to reject it. To tell them why, reply to this message before rejecting.", emojiApprove, emojiReject)
+	// the report is cut first, it's last
+	content := truncateMessage(header+report, 2000-len(footer)) + footer
+	if len(previews) > maxAttachments {
+		previews = previews[:maxAttachments]
+	}
+	msg, err := f.session.ChannelMessageSendComplex(config.GetReviewChannel(), &discordgo.MessageSend{
+		Content: content,
+		Files:   previews,
+	})
+	if err != nil {
+		log.Printf("error posting %q for review: %v\n", f.name, err)
+		f.session.ChannelMessageSend(pm.ID, fmt.Sprintf("Sorry, I couldn't send `%s` for review", f.name))
+		return
+	}
+	f.session.MessageReactionAdd(msg.ChannelID, msg.ID, emojiApprove)
+	f.session.MessageReactionAdd(msg.ChannelID, msg.ID, emojiReject)
+
+	err = store.AddPendingUpload(&pb.PendingUpload{
+		Id:              path.Base(f.stageDir),
+		Timestamp:       time.Now().Unix(),
+		UserId:          f.message.Author.ID,
+		Username:        f.message.Author.Username,
+		Filename:        f.name,
+		Files:           files,
+		Bytes:           size,
+		ChannelId:       f.message.ChannelID,
+		ReviewMessageId: msg.ID,
+		Report:          report,
+		RepoHashes:      repoHashes(files),
+	})
+	if err != nil {
+		log.Printf("error saving pending upload %q: %v\n", f.name, err)
+		f.session.ChannelMessageDelete(msg.ChannelID, msg.ID)
+		f.session.ChannelMessageSend(pm.ID, fmt.Sprintf("Sorry, I couldn't send `%s` for review", f.name))
+		return
+	}
+	f.staged = true
+	f.session.ChannelMessageSend(pm.ID, fmt.Sprintf("`%s` looks good, it'll be committed once a moderator has approved it.", f.name))
+	log.Printf("%q staged for review\n", f.name)
+}
+
+// handleReviewReaction approves or rejects a pending upload when a moderator
+// reacts to its review message. Returns false if the message isn't a review.
+func handleReviewReaction(s *discordgo.Session, r *discordgo.MessageReactionAdd) bool {
+	if r.ChannelID != config.GetReviewChannel() {
+		return false
+	}
+	if r.Emoji.Name != emojiApprove && r.Emoji.Name != emojiReject {
+		return false
+	}
+	reviewMu.Lock()
+	defer reviewMu.Unlock()
+	p, err := store.PendingUpload(r.MessageID)
+	if err != nil {
+		log.Println("error reading pending upload:", err)
+		return true
+	}
+	if p == nil {
+		return false
+	}
+	if !authorized(s, r.GuildID, r.UserID, r.Member, pb.Capability_MODERATE) {
+		return true
+	}
+	if r.Emoji.Name == emojiReject {
+		rejectUpload(s, p, r.UserID)
+		return true
+	}
+	queueApproval(s, r.MessageID, r.UserID, false)
+	return true
+}
+
+// queueApproval queues committing a pending upload, committing has to wait
+// its turn with everything else changing the repo. If force is set, files
+// changed in the repo since it was staged are replaced without asking.
+func queueApproval(s *discordgo.Session, reviewMessageID, moderatorID string, force bool) {
+	p, err := store.PendingUpload(reviewMessageID)
+	if err != nil || p == nil {
+		return
+	}
+	what := fmt.Sprintf("approved `%s`", p.GetFilename())
+	ahead, ok := repoJobs.add(&repoJob{
+		description: fmt.Sprintf("%s from %s", what, p.GetUsername()),
+		run: func() {
+			reviewMu.Lock()
+			defer reviewMu.Unlock()
+			// it may have been handled while this was waiting
+			p, err := store.PendingUpload(reviewMessageID)
+			if err != nil || p == nil {
+				return
+			}
+			approveUpload(s, p, moderatorID, force)
+		},
+	})
+	ref := &discordgo.MessageReference{MessageID: reviewMessageID, ChannelID: config.GetReviewChannel()}
+	if !ok {
+		s.ChannelMessageSendReply(ref.ChannelID, queueFullMessage(what), ref)
+	} else if msg := queuedMessage(what, ahead); msg != "" {
+		s.ChannelMessageSendReply(ref.ChannelID, msg, ref)
+	}
+}
+
+// repoHashes returns the sha256 (hex) of each of files in the repo, or "" for
+// the ones that aren't there.
+func repoHashes(files []string) map[string]string {
+	hashes := map[string]string{}
+	for _, name := range files {
+		hashes[name] = ""
+		if sum, ok := hashFile(path.Join(config.GetRepoPath(), name)); ok {
+			hashes[name] = hex.EncodeToString(sum[:])
+		}
+	}
+	return hashes
+}
+
+// changedSinceStaged returns the files of a pending upload that have been
+// added or changed in the repo since it was staged. The overwrite policy was
+// applied to what was there then, it doesn't cover anything newer.
+func changedSinceStaged(p *pb.PendingUpload) []string {
+	var changed []string
+	now := repoHashes(p.GetFiles())
+	for _, name := range p.GetFiles() {
+		if now[name] != p.GetRepoHashes()[name] {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// confirmChangedFiles asks for someone allowed to overwrite files to say
+// whether an approved upload should replace files changed since it was
+// staged. If they say yes it's queued again, otherwise it's left waiting
+// for review.
+func confirmChangedFiles(s *discordgo.Session, p *pb.PendingUpload, moderatorID string, changed []string) {
+	msg := fmt.Sprintf(
+		"These files have changed in the repo since `%s` was uploaded:\n```\n%s\n```Someone allowed to replace files needs to react %s to replace them anyway or %s to leave it waiting for review.",
+		p.GetFilename(), listNames(changed, maxReviewFiles), emojiApprove, emojiReject,
+	)
+	reviewMessageID := p.GetReviewMessageId()
+	go func() {
+		ok := requestConfirmation(s, config.GetReviewChannel(), msg, func(r *discordgo.MessageReactionAdd) bool {
+			return authorized(s, r.GuildID, r.UserID, r.Member, pb.Capability_OVERWRITE)
+		})
+		log.Printf("replacing changed files with %q approved: %v\n", p.GetFilename(), ok)
+		if ok {
+			queueApproval(s, reviewMessageID, moderatorID, true)
+		}
+	}()
+}
+
+// noteRejectReason saves a moderator's reply to a review message as the
+// reason for rejecting it. Returns false if the message isn't one.
+func noteRejectReason(s *discordgo.Session, m *discordgo.MessageCreate) bool {
+	if m.ChannelID != config.GetReviewChannel() || m.MessageReference == nil {
+		return false
+	}
+	reviewMu.Lock()
+	defer reviewMu.Unlock()
+	p, err := store.PendingUpload(m.MessageReference.MessageID)
+	if err != nil || p == nil {
+		return false
+	}
+	if !authorized(s, m.GuildID, m.Author.ID, m.Member, pb.Capability_MODERATE) {
+		return false
+	}
+	p.Reason = m.Content
+	err = store.AddPendingUpload(p)
+	if err != nil {
+		log.Println("error saving rejection reason:", err)
+		return true
+	}
+	s.MessageReactionAdd(m.ChannelID, m.ID, "📝")
+	return true
+}
+
+// approveUpload copies a staged upload into the repo and commits it. Unless
+// force is set, files changed in the repo since it was staged aren't
+// replaced without asking first.
+func approveUpload(s *discordgo.Session, p *pb.PendingUpload, moderatorID string, force bool) {
+	ref := &discordgo.MessageReference{MessageID: p.GetReviewMessageId(), ChannelID: config.GetReviewChannel()}
+	if changed := changedSinceStaged(p); len(changed) > 0 && !force {
+		confirmChangedFiles(s, p, moderatorID, changed)
+		return
+	}
+	stageDir := path.Join(config.GetStagingPath(), p.GetId())
+	for _, name := range p.GetFiles() {
+		var dst string
+		src, err := safeJoin(stageDir, name)
+		if err == nil {
+			dst, err = safeJoin(config.GetRepoPath(), name)
+		}
+		if err == nil {
+			err = copyFile(src, dst)
+		}
+		if err != nil {
+			log.Printf("error copying staged %q to the repo: %v\n", name, err)
+			if rerr := NewGit(config.GetRepoPath()).restore(p.GetFiles()...); rerr != nil {
+				log.Println(rerr)
+			}
+			s.ChannelMessageSendReply(ref.ChannelID, fmt.Sprintf("Unable to copy `%s` into the repo, it's still waiting for review", name), ref)
+			return
+		}
+	}
+	msg := fmt.Sprintf("Added %s, submitted by %s[%s], approved by %s", p.GetFilename(), p.GetUsername(), p.GetUserId(), moderatorID)
+	commit, prURL, err := commitUpload(&commitRequest{
+		session:  s,
+		message:  msg,
+		author:   commitAuthor(p.GetUsername(), p.GetUserId()),
+		username: p.GetUsername(),
+		filename: p.GetFilename(),
+		files:    p.GetFiles(),
+	})
+	if err != nil && !errors.Is(err, errPushPending) {
+		log.Println("git error:", err)
+		s.ChannelMessageSendReply(ref.ChannelID, "Unable to commit this, it's still waiting for review", ref)
+		return
+	}
+	pushErr := err
+	err = store.AddUpload(&pb.UploadRecord{
+		Timestamp: time.Now().Unix(),
+		UserId:    p.GetUserId(),
+		Username:  p.GetUsername(),
+		Filename:  p.GetFilename(),
+		Files:     p.GetFiles(),
+		Bytes:     p.GetBytes(),
+		Commit:    commit,
+	})
+	if err != nil {
+		log.Printf("error recording upload of %q: %v\n", p.GetFilename(), err)
+	}
+	finishReview(p)
+	report := p.GetReport()
+	announce := fmt.Sprintf("`%s` from <@%s> has been added", p.GetFilename(), p.GetUserId())
+	if pushErr != nil {
+		report += "\n" + pushPendingNote
+	}
+	if prURL != "" {
+		report += "\nPull request: " + prURL
+		announce = fmt.Sprintf("`%s` from <@%s> is ready to merge: %s", p.GetFilename(), p.GetUserId(), prURL)
+	}
+	s.ChannelMessageSendReply(ref.ChannelID, fmt.Sprintf("Approved by <@%s>", moderatorID), ref)
+	sendDM(s, p.GetUserId(), report)
+	s.ChannelMessageSend(p.GetChannelId(), announce)
+	log.Printf("%q approved by %s and committed to git repo\n", p.GetFilename(), moderatorID)
+}
+
+// rejectUpload throws away a staged upload and tells the uploader why.
+func rejectUpload(s *discordgo.Session, p *pb.PendingUpload, moderatorID string) {
+	ref := &discordgo.MessageReference{MessageID: p.GetReviewMessageId(), ChannelID: config.GetReviewChannel()}
+	finishReview(p)
+	reason := p.GetReason()
+	if reason == "" {
+		reason = "no reason given"
+	}
+	s.ChannelMessageSendReply(ref.ChannelID, fmt.Sprintf("Rejected by <@%s>", moderatorID), ref)
+	sendDM(s, p.GetUserId(), fmt.Sprintf("`%s` was rejected by a moderator: %s", p.GetFilename(), reason))
+	log.Printf("%q rejected by %s\n", p.GetFilename(), moderatorID)
+}
+
+// finishReview forgets a pending upload and removes its staged files.
+func finishReview(p *pb.PendingUpload) {
+	err := store.RemovePendingUpload(p.GetReviewMessageId())
+	if err != nil {
+		log.Printf("error removing pending upload %q: %v\n", p.GetFilename(), err)
+	}
+	err = os.RemoveAll(path.Join(config.GetStagingPath(), p.GetId()))
+	if err != nil {
+		log.Printf("error removing staged files for %q: %v\n", p.GetFilename(), err)
+	}
+}
+
+// copyFile copies src to dst, creating any directories needed.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// checkPath makes sure a file name from an upload (usually from inside an
+// archive, so anything goes) is a plain relative path that can't be used to
+// write outside of where it's extracted.
+func checkPath(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("empty file name")
+	case strings.ContainsAny(name, "\\\x00"):
+		return fmt.Errorf("backslash or NUL in name")
+	case strings.HasPrefix(name, "/"), len(name) > 1 && name[1] == ':':
+		return fmt.Errorf("absolute path")
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." || part == "." {
+			return fmt.Errorf("relative path component %q", part)
+		}
+		if strings.EqualFold(part, ".git") {
+			return fmt.Errorf("inside .git")
+		}
+	}
+	if path.Clean(name) != name {
+		return fmt.Errorf("not a clean path")
+	}
+	return nil
+}
+
+// checkEntryName makes sure a file name is safe (see checkPath) and inside
+// one of the mod directories, so it's somewhere we're willing to write.
+func checkEntryName(name string) error {
+	if err := checkPath(name); err != nil {
+		return err
+	}
+	if !hasPrefix(name, assetDirs) {
+		return fmt.Errorf("not in a mod directory")
+	}
+	return nil
+}
+
+// checkEntryNames checks every file name in an archive is safe, even the
+// ones that would be skipped: an archive trying to escape is rejected
+// outright. No two names can differ only by case either, they'd overwrite
+// each other on some filesystems and the game treats them as the same file.
+// Returns a description of each problem, or nil if there aren't any.
+func checkEntryNames(names []string) []string {
+	var problems []string
+	seen := map[string]string{}
+	for _, name := range names {
+		if err := checkPath(name); err != nil {
+			problems = append(problems, fmt.Sprintf("%q: %v", name, err))
+			continue
+		}
+		lower := strings.ToLower(name)
+		if other, ok := seen[lower]; ok {
+			problems = append(problems, fmt.Sprintf("%q: same name as %q apart from case", name, other))
+			continue
+		}
+		seen[lower] = name
+	}
+	return problems
+}
+
+// checkArchiveEntries runs checkEntryNames over everything in an archive,
+// and doesn't allow symlinks at all.
+func checkArchiveEntries(entries []ArchiveEntry) []string {
+	var checked, problems []string
+	for _, e := range entries {
+		// "maps/" is fine for a directory
+		checked = append(checked, strings.TrimSuffix(e.Name, "/"))
+		if e.Symlink {
+			problems = append(problems, fmt.Sprintf("%q: symlink", e.Name))
+		}
+	}
+	return append(problems, checkEntryNames(checked)...)
+}
+
+// safeJoin returns the full path of rel under root. rel must pass
+// checkEntryName, and nothing between root and the file can be a symlink
+// (which could point outside of root).
+func safeJoin(root, rel string) (string, error) {
+	if err := checkEntryName(rel); err != nil {
+		return "", fmt.Errorf("%q: %v", rel, err)
+	}
+	full := root
+	for _, part := range strings.Split(rel, "/") {
+		full = filepath.Join(full, part)
+		st, err := os.Lstat(full)
+		if os.IsNotExist(err) {
+			// nothing further along can exist either
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if st.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%q: %q is a symlink", rel, full)
+		}
+	}
+	return filepath.Join(root, filepath.FromSlash(rel)), nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPath(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"maps/q2dm1.bsp", true},
+		{"textures/e1u1/floor1_3.wal", true},
+		{"readme.txt", true},
+		{"", false},
+		{"../maps/q2dm1.bsp", false},
+		{"maps/../../etc/passwd", false},
+		{"maps/..", false},
+		{"maps/./q2dm1.bsp", false},
+		{"/etc/passwd", false},
+		{"C:/windows/system.ini", false},
+		{"c:maps/q2dm1.bsp", false},
+		{`maps\q2dm1.bsp`, false},
+		{`..\..\evil.bsp`, false},
+		{"maps/q2dm1.bsp\x00.txt", false},
+		{".git/config", false},
+		{"maps/.GIT/hooks/post-commit", false},
+		{"maps//q2dm1.bsp", false},
+		{"maps/", false},
+	}
+	for _, tc := range tests {
+		err := checkPath(tc.name)
+		if (err == nil) != tc.ok {
+			t.Errorf("checkPath(%q) = %v, want ok %v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestCheckEntryName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"maps/q2dm1.bsp", true},
+		{"sound/world/amb1.wav", true},
+		{"readme.txt", false},
+		{"mapsx/q2dm1.bsp", false},
+		{"maps/../q2dm1.bsp", false},
+	}
+	for _, tc := range tests {
+		err := checkEntryName(tc.name)
+		if (err == nil) != tc.ok {
+			t.Errorf("checkEntryName(%q) = %v, want ok %v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestCheckEntryNames(t *testing.T) {
+	tests := []struct {
+		desc     string
+		names    []string
+		problems int
+	}{
+		{"fine", []string{"maps/a.bsp", "maps/b.bsp", "readme.txt"}, 0},
+		{"escape", []string{"maps/a.bsp", "../a.bsp"}, 1},
+		{"absolute", []string{"/maps/a.bsp"}, 1},
+		{"case variants", []string{"maps/A.bsp", "maps/a.bsp"}, 1},
+		{"case variant directories", []string{"Maps/a.bsp", "maps/a.bsp", "MAPS/A.BSP"}, 2},
+		{"several", []string{`maps\a.bsp`, ".git/HEAD", "maps/a.bsp"}, 2},
+	}
+	for _, tc := range tests {
+		if got := checkEntryNames(tc.names); len(got) != tc.problems {
+			t.Errorf("%s: checkEntryNames(%q) = %q, want %d problems", tc.desc, tc.names, got, tc.problems)
+		}
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "textures"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "maps")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "textures", "e1u1")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rel  string
+		want string // "" for an error
+	}{
+		{"sound/world/amb1.wav", filepath.Join(root, "sound", "world", "amb1.wav")},
+		{"textures/e2u1/floor.wal", filepath.Join(root, "textures", "e2u1", "floor.wal")},
+		{"maps/q2dm1.bsp", ""},
+		{"textures/e1u1/floor.wal", ""},
+		{"../outside.bsp", ""},
+		{"readme.txt", ""},
+	}
+	for _, tc := range tests {
+		got, err := safeJoin(root, tc.rel)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("safeJoin(%q) = %q, want an error", tc.rel, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("safeJoin(%q) = %q, %v, want %q", tc.rel, got, err, tc.want)
+		}
+	}
+}
+
+func FuzzCheckPath(f *testing.F) {
+	for _, seed := range []string{"maps/q2dm1.bsp", "../x", "/x", "C:/x", `a\b`, "a/./b", ".git/x", "a\x00b"} {
+		f.Add(seed)
+	}
+	root := filepath.FromSlash("/repo")
+	f.Fuzz(func(t *testing.T, name string) {
+		if checkPath(name) != nil {
+			return
+		}
+		if strings.ContainsAny(name, "\\\x00") {
+			t.Fatalf("checkPath(%q) allowed a backslash or NUL", name)
+		}
+		full := filepath.Join(root, filepath.FromSlash(name))
+		rel, err := filepath.Rel(root, full)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+			t.Fatalf("checkPath(%q) allowed a path outside the root: %q", name, full)
+		}
+		for _, part := range strings.Split(name, "/") {
+			if strings.EqualFold(part, ".git") {
+				t.Fatalf("checkPath(%q) allowed a path in .git", name)
+			}
+		}
+	})
+}
+
+// Archives trying to write outside of the repo, or somewhere they shouldn't,
+// have to be caught by checkArchiveEntries whatever the format.
+func TestMaliciousArchives(t *testing.T) {
+	tests := []struct {
+		desc  string
+		ext   string
+		write func(*testing.T, string, []testFile)
+		files []testFile
+	}{
+		{"zip parent dir", ".zip", writeTestZip, []testFile{{name: "maps/ok.bsp", data: "x"}, {name: "../../evil.bsp", data: "x"}}},
+		{"zip absolute", ".zip", writeTestZip, []testFile{{name: "/etc/cron.d/evil", data: "x"}}},
+		{"zip drive letter", ".pk3", writeTestZip, []testFile{{name: "C:/evil.bsp", data: "x"}}},
+		{"zip backslashes", ".zip", writeTestZip, []testFile{{name: `maps\..\..\evil.bsp`, data: "x"}}},
+		{"zip git dir", ".zip", writeTestZip, []testFile{{name: "maps/.git/hooks/post-commit", data: "x"}}},
+		{"zip case variants", ".zip", writeTestZip, []testFile{{name: "maps/Q2DM1.bsp", data: "x"}, {name: "maps/q2dm1.bsp", data: "y"}}},
+		{"pak parent dir", ".pak", writeTestPAK, []testFile{{name: "maps/ok.bsp", data: "x"}, {name: "maps/../../evil.bsp", data: "x"}}},
+		{"pak absolute", ".pak", writeTestPAK, []testFile{{name: "/tmp/evil", data: "x"}}},
+		{"pak git dir", ".pak", writeTestPAK, []testFile{{name: ".git/config", data: "x"}}},
+		{"pak case variants", ".pak", writeTestPAK, []testFile{{name: "textures/A.wal", data: "x"}, {name: "textures/a.wal", data: "y"}}},
+		{"7z parent dir", ".7z", writeTest7Z, []testFile{{name: "../evil.bsp", data: "x"}}},
+		{"7z windows separators", ".7z", writeTest7Z, []testFile{{name: `maps\..\..\evil.bsp`, data: "x"}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "upload"+tc.ext)
+			tc.write(t, filename, tc.files)
+			archive, err := openAssetArchive(tc.ext, filename, "upload"+tc.ext, [32]byte{})
+			if err != nil {
+				// refusing to open it at all is fine too
+				t.Logf("openAssetArchive() error: %v", err)
+				return
+			}
+			defer archive.Close()
+			if problems := checkArchiveEntries(archive.Entries()); len(problems) == 0 {
+				t.Errorf("checkArchiveEntries() found no problems with %q", tc.files)
+			}
+		})
+	}
+}
+
+func TestSymlinkInZip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "upload.zip")
+	fp, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(fp)
+	fh := &zip.FileHeader{Name: "maps/q2dm1.bsp"}
+	fh.SetMode(os.ModeSymlink | 0777)
+	w, err := zw.CreateHeader(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("/etc/passwd"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fp.Close()
+
+	archive, err := openAssetArchive(".zip", filename, "upload.zip", [32]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	if problems := checkArchiveEntries(archive.Entries()); len(problems) != 1 {
+		t.Errorf("checkArchiveEntries() = %q, want the symlink rejected", problems)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+// channelServers returns the configured servers that can be used from the
+// given channel. Servers without an owning channel are usable everywhere.
+func channelServers(channelID string) []*pb.Server {
+	var out []*pb.Server
+	for _, s := range config.GetServers() {
+		if s.GetChannel() == "" || s.GetChannel() == channelID {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].GetAlias() < out[j].GetAlias()
+	})
+	return out
+}
+
+// resolveServer will turn what a user typed into a server address. Anything
+// that looks like host:port is used as-is, otherwise it has to match the
+// alias of a configured server (case-insensitive) usable in this channel.
+func resolveServer(channelID, name string) (string, error) {
+	if strings.Contains(name, ":") {
+		return name, nil
+	}
+	for _, s := range channelServers(channelID) {
+		if strings.EqualFold(s.GetAlias(), name) {
+			return s.GetAddress(), nil
+		}
+	}
+	return "", fmt.Errorf("unknown server %q", name)
+}
+
+// formatServerList will build a listing of the servers usable in the
+// channel, one per line.
+func formatServerList(channelID string) string {
+	servers := channelServers(channelID)
+	if len(servers) == 0 {
+		return "No servers are configured, use `!q2 <host:port>`"
+	}
+	output := "```\n"
+	for _, s := range servers {
+		output += fmt.Sprintf("%-10s %-24s %s\n", s.GetAlias(), s.GetAddress(), s.GetDescription())
+	}
+	return output + "```"
+}
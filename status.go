@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/packetflinger/libq2/state"
+)
+
+// embed colors for server status
+const (
+	colorEmpty  = 0x95a5a6 // grey
+	colorActive = 0x2ecc71 // green
+	colorFull   = 0xe74c3c // red
+)
+
+// Discord rejects an embed with a field value over 1024 characters, a big
+// scoreboard is split over a few fields and the rest left off.
+const (
+	maxFieldLength      = 1024
+	maxScoreboardFields = 4
+)
+
+// cmdServerStatus will query a Quake 2 server and reply with a summary of
+// what's going on there. With no server named, the configured servers are
+// listed instead.
+func cmdServerStatus(r *commandRequest) {
+	if len(r.args) == 0 {
+		cmdServerList(r)
+		return
+	}
+	info, err := fetchServerInfo(r)
+	if err != nil {
+		return
+	}
+	r.replyComplex(statusMessage(r.channelID, info))
+}
+
+// cmdServerPlayers will query a Quake 2 server and reply with who is playing.
+func cmdServerPlayers(r *commandRequest) {
+	info, err := fetchServerInfo(r)
+	if err != nil {
+		return
+	}
+	r.reply(formatPlayers(info))
+}
+
+// cmdServerList will reply with the servers that can be referred to by alias
+// in this channel.
+func cmdServerList(r *commandRequest) {
+	r.reply(formatServerList(r.channelID))
+}
+
+// fetchServerInfo will get the current status from the server named in the
+// first argument of the request. Errors are logged and reported back to the
+// user.
+func fetchServerInfo(r *commandRequest) (state.ServerInfo, error) {
+	if len(r.args) != 1 {
+		r.reply("Usage: `!q2 [status|players] <alias|host:port>`")
+		return state.ServerInfo{}, fmt.Errorf("wrong number of arguments: %d", len(r.args))
+	}
+	arg := r.args[0]
+	log.Printf("%s[%s] requesting server status: %s\n", r.user.Username, r.user.ID, arg)
+	addr, err := resolveServer(r.channelID, arg)
+	if err != nil {
+		r.reply(fmt.Sprintf("I don't know a server called `%s`. Try one of these:\n%s", arg, formatServerList(r.channelID)))
+		return state.ServerInfo{}, err
+	}
+	srv, err := state.NewServer(addr)
+	if err != nil {
+		log.Println(err)
+		r.reply(fmt.Sprintf("`%s` isn't a valid server address", arg))
+		return state.ServerInfo{}, err
+	}
+	info, err := srv.FetchInfo()
+	if err != nil {
+		log.Println("serverinfo fetch fail:", err)
+		r.reply(fmt.Sprintf("unable to get status from `%s`", arg))
+		return state.ServerInfo{}, err
+	}
+	return info, nil
+}
+
+// Format the ServerInfo output for printing
+func formatStatus(info state.ServerInfo) string {
+	output := fmt.Sprintf(
+		"%s\n%s - %s/%s",
+		info.Server["hostname"],
+		info.Server["mapname"],
+		info.Server["player_count"],
+		info.Server["maxclients"],
+	)
+	if info.Server["gamedir"] == "opentdm" {
+		if info.Server["time_remaining"] != "WARMUP" {
+			output = fmt.Sprintf(
+				"%s\nMatch time remaining: %s\nScore: %s:%s",
+				output,
+				info.Server["time_remaining"],
+				info.Server["score_a"],
+				info.Server["score_b"],
+			)
+		}
+	}
+	if len(info.Players) > 0 {
+		var players []string
+		for _, p := range info.Players {
+			players = append(players, strings.ReplaceAll(p.Name, "`", "'"))
+		}
+		output += fmt.Sprintf("\n[`%s`]", strings.Join(players, ", "))
+	}
+	return output
+}
+
+// statusMessage builds the status reply for a channel. Channels listed in
+// text_status_channels get the plain text version, everyone else gets an
+// embed.
+func statusMessage(channelID string, info state.ServerInfo) *discordgo.MessageSend {
+	if contains(channelID, config.GetTextStatusChannels()) {
+		return &discordgo.MessageSend{Content: formatStatus(info)}
+	}
+	return &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{formatStatusEmbed(info)}}
+}
+
+// Format the ServerInfo output as a Discord embed. The color of the embed
+// shows at a glance if the server is empty, has people on it, or is full.
+func formatStatusEmbed(info state.ServerInfo) *discordgo.MessageEmbed {
+	players, _ := strconv.Atoi(info.Server["player_count"])
+	maxclients, _ := strconv.Atoi(info.Server["maxclients"])
+	color := colorActive
+	if players == 0 {
+		color = colorEmpty
+	} else if maxclients > 0 && players >= maxclients {
+		color = colorFull
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: info.Server["hostname"],
+		Color: color,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Map", Value: valueOrDash(info.Server["mapname"]), Inline: true},
+			{Name: "Players", Value: fmt.Sprintf("%d/%d", players, maxclients), Inline: true},
+			{Name: "Game", Value: valueOrDash(info.Server["gamedir"]), Inline: true},
+		},
+	}
+	if info.Server["gamedir"] == "opentdm" && info.Server["time_remaining"] != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Match", Value: info.Server["time_remaining"], Inline: true,
+		})
+		if info.Server["time_remaining"] != "WARMUP" {
+			embed.Fields = append(embed.Fields,
+				&discordgo.MessageEmbedField{Name: "Team A", Value: valueOrDash(info.Server["score_a"]), Inline: true},
+				&discordgo.MessageEmbedField{Name: "Team B", Value: valueOrDash(info.Server["score_b"]), Inline: true},
+			)
+		}
+	}
+	var tables []string
+	header := fmt.Sprintf("%-16s %5s %5s\n", "name", "score", "ping")
+	table := header
+	for i, p := range info.Players {
+		row := playerRow(p.Name, p.Score, p.Ping)
+		if len("```\n"+table+row+"```") > maxFieldLength {
+			tables = append(tables, table)
+			table = header
+			if len(tables) == maxScoreboardFields {
+				table = ""
+				embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("... and %d more players", len(info.Players)-i)}
+				break
+			}
+		}
+		table += row
+	}
+	if table != header && table != "" {
+		tables = append(tables, table)
+	}
+	for i, t := range tables {
+		name := "Scoreboard"
+		if i > 0 {
+			name += " (continued)"
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: name, Value: "```\n" + t + "```",
+		})
+	}
+	return embed
+}
+
+// playerRow is a line of a scoreboard. Names are cut to fit the column, and
+// can't be allowed to end the code block the table is in.
+func playerRow(name string, score, ping int) string {
+	name = strings.ReplaceAll(name, "`", "'")
+	if r := []rune(name); len(r) > 16 {
+		name = string(r[:16])
+	}
+	return fmt.Sprintf("%-16s %5d %5d\n", name, score, ping)
+}
+
+// Embed field values can't be empty.
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Format the player list from the ServerInfo as a table of name, score and
+// ping.
+func formatPlayers(info state.ServerInfo) string {
+	if len(info.Players) == 0 {
+		return fmt.Sprintf("%s\nno players", info.Server["hostname"])
+	}
+	output := fmt.Sprintf("%s\n```\n%-16s %5s %5s\n", info.Server["hostname"], "name", "score", "ping")
+	for _, p := range info.Players {
+		output += playerRow(p.Name, p.Score, p.Ping)
+	}
+	return truncateMessage(output+"```", 2000)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/packetflinger/libq2/state"
+)
+
+func testServerInfo(players int) state.ServerInfo {
+	info := state.ServerInfo{Server: map[string]string{
+		"hostname":     "test server",
+		"mapname":      "q2dm1",
+		"player_count": fmt.Sprint(players),
+		"maxclients":   "256",
+		"gamedir":      "baseq2",
+	}}
+	for i := 0; i < players; i++ {
+		info.Players = append(info.Players, struct {
+			Name  string
+			Score int
+			Ping  int
+		}{Name: fmt.Sprintf("player```%d", i), Score: i, Ping: 50})
+	}
+	return info
+}
+
+func TestFormatStatusEmbedScoreboard(t *testing.T) {
+	for _, players := range []int{0, 1, 35, 256} {
+		embed := formatStatusEmbed(testServerInfo(players))
+		listed := 0
+		boards := 0
+		for _, f := range embed.Fields {
+			if len(f.Value) > maxFieldLength {
+				t.Errorf("%d players: field %q is %d long", players, f.Name, len(f.Value))
+			}
+			if !strings.HasPrefix(f.Name, "Scoreboard") {
+				continue
+			}
+			boards++
+			if strings.Count(f.Value, "```") != 2 {
+				t.Errorf("%d players: a name broke the code block:\n%s", players, f.Value)
+			}
+			listed += strings.Count(f.Value, "\n") - 2 // the opening line and the header
+		}
+		if boards > maxScoreboardFields {
+			t.Errorf("%d players: %d scoreboard fields", players, boards)
+		}
+		if listed == players {
+			if embed.Footer != nil {
+				t.Errorf("%d players: footer %q with everyone listed", players, embed.Footer.Text)
+			}
+			continue
+		}
+		if embed.Footer == nil || embed.Footer.Text != fmt.Sprintf("... and %d more players", players-listed) {
+			t.Errorf("%d players: listed %d, footer %+v", players, listed, embed.Footer)
+		}
+	}
+}
+
+func TestFormatPlayersLength(t *testing.T) {
+	got := formatPlayers(testServerInfo(256))
+	if len(got) > 2000 {
+		t.Errorf("formatPlayers() is %d long", len(got))
+	}
+	if strings.Count(got, "```")%2 != 0 {
+		t.Errorf("formatPlayers() left a code block open")
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/packetflinger/discordbot/proto"
+)
+
+// Store is where the bot keeps anything it needs to remember across
+// restarts.
+type Store interface {
+	// AddUpload records a file that was committed to the repo.
+	AddUpload(*pb.UploadRecord) error
+	// Uploads returns up to limit of the most recent uploads, newest first.
+	// If userID isn't empty, only uploads from that user are included.
+	Uploads(limit int, userID string) ([]*pb.UploadRecord, error)
+
+	// AddServerStatus records the result of polling a server.
+	AddServerStatus(*pb.StatusRecord) error
+	// PruneServerStatus removes polls older than a time for all servers.
+	PruneServerStatus(before time.Time) error
+
+	// Watchlist returns the player names a user is watching for.
+	Watchlist(userID string) (*pb.Watchlist, error)
+	// SetWatchlist replaces a user's watchlist. An empty list removes it.
+	SetWatchlist(userID string, wl *pb.Watchlist) error
+	// Watchlists returns everyone's watchlist, keyed by user ID.
+	Watchlists() (map[string]*pb.Watchlist, error)
+
+	// MessageID returns the Discord message ID saved under a key, or "" if
+	// there isn't one.
+	MessageID(key string) (string, error)
+	// SetMessageID saves a Discord message ID under a key.
+	SetMessageID(key, id string) error
+
+	// AddPendingUpload saves an upload waiting for review, keyed by its
+	// review message ID.
+	AddPendingUpload(*pb.PendingUpload) error
+	// PendingUpload returns the upload being reviewed in a message, or nil
+	// if there isn't one.
+	PendingUpload(reviewMessageID string) (*pb.PendingUpload, error)
+	// RemovePendingUpload forgets an upload once it's been reviewed.
+	RemovePendingUpload(reviewMessageID string) error
+
+	Close() error
+}
+
+// our database, opened in main()
+var store Store
+
+// bucket names
+var (
+	bucketMeta       = []byte("meta")
+	bucketUploads    = []byte("uploads")
+	bucketStatus     = []byte("status")
+	bucketWatchlists = []byte("watchlists")
+	bucketMessages   = []byte("messages")
+	bucketPending    = []byte("pending")
+
+	keySchemaVersion = []byte("schema_version")
+)
+
+// migrations bring the database schema up to date. Each one runs exactly
+// once, in order, and the index+1 is recorded as the schema version. Only
+// ever append to this list.
+var migrations = []func(tx *bolt.Tx) error{
+	migrateCreateBuckets,
+	migrateCreatePending,
+}
+
+// boltStore is a Store in a single bbolt database file.
+type boltStore struct {
+	db *bolt.DB
+}
+
+// openStore will open (or create) the database at the path and run any
+// migrations that haven't been applied yet.
+func openStore(dbPath string) (Store, error) {
+	err := os.MkdirAll(path.Dir(dbPath), 0700)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening %q: %v", dbPath, err)
+	}
+	st := &boltStore{db: db}
+	err = st.migrate()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// migrate applies any migrations newer than the database's schema version.
+func (b *boltStore) migrate() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		version := 0
+		if v := meta.Get(keySchemaVersion); v != nil {
+			version = int(binary.BigEndian.Uint64(v))
+		}
+		if version > len(migrations) {
+			return fmt.Errorf("database schema version %d is newer than this bot (%d)", version, len(migrations))
+		}
+		for i := version; i < len(migrations); i++ {
+			err = migrations[i](tx)
+			if err != nil {
+				return fmt.Errorf("schema migration %d failed: %v", i+1, err)
+			}
+			log.Printf("applied database schema migration %d\n", i+1)
+		}
+		return meta.Put(keySchemaVersion, itob(uint64(len(migrations))))
+	})
+}
+
+// Schema version 1: the initial set of buckets.
+func migrateCreateBuckets(tx *bolt.Tx) error {
+	for _, name := range [][]byte{bucketUploads, bucketStatus, bucketWatchlists, bucketMessages} {
+		_, err := tx.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Schema version 2: uploads waiting for review.
+func migrateCreatePending(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(bucketPending)
+	return err
+}
+
+func (b *boltStore) AddUpload(u *pb.UploadRecord) error {
+	data, err := proto.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(bucketUploads)
+		seq, err := bk.NextSequence()
+		if err != nil {
+			return err
+		}
+		return bk.Put(itob(seq), data)
+	})
+}
+
+func (b *boltStore) Uploads(limit int, userID string) ([]*pb.UploadRecord, error) {
+	var out []*pb.UploadRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketUploads).Cursor()
+		for k, v := c.Last(); k != nil && len(out) < limit; k, v = c.Prev() {
+			u := &pb.UploadRecord{}
+			err := proto.Unmarshal(v, u)
+			if err != nil {
+				return err
+			}
+			if userID != "" && u.GetUserId() != userID {
+				continue
+			}
+			out = append(out, u)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Polls are kept in a nested bucket per server, keyed by timestamp so they
+// sort in time order.
+func (b *boltStore) AddServerStatus(s *pb.StatusRecord) error {
+	data, err := proto.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk, err := tx.Bucket(bucketStatus).CreateBucketIfNotExists([]byte(s.GetAlias()))
+		if err != nil {
+			return err
+		}
+		return bk.Put(itob(uint64(s.GetTimestamp())), data)
+	})
+}
+
+func (b *boltStore) PruneServerStatus(before time.Time) error {
+	end := itob(uint64(before.Unix()))
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketStatus).ForEach(func(alias, _ []byte) error {
+			c := tx.Bucket(bucketStatus).Bucket(alias).Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.First() {
+				err := c.Delete()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (b *boltStore) Watchlist(userID string) (*pb.Watchlist, error) {
+	wl := &pb.Watchlist{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketWatchlists).Get([]byte(userID))
+		if v == nil {
+			return nil
+		}
+		return proto.Unmarshal(v, wl)
+	})
+	return wl, err
+}
+
+func (b *boltStore) SetWatchlist(userID string, wl *pb.Watchlist) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(bucketWatchlists)
+		if len(wl.GetNames()) == 0 {
+			return bk.Delete([]byte(userID))
+		}
+		data, err := proto.Marshal(wl)
+		if err != nil {
+			return err
+		}
+		return bk.Put([]byte(userID), data)
+	})
+}
+
+func (b *boltStore) Watchlists() (map[string]*pb.Watchlist, error) {
+	out := map[string]*pb.Watchlist{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketWatchlists).ForEach(func(k, v []byte) error {
+			wl := &pb.Watchlist{}
+			err := proto.Unmarshal(v, wl)
+			if err != nil {
+				return err
+			}
+			out[string(k)] = wl
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (b *boltStore) MessageID(key string) (string, error) {
+	var id string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		id = string(tx.Bucket(bucketMessages).Get([]byte(key)))
+		return nil
+	})
+	return id, err
+}
+
+func (b *boltStore) SetMessageID(key, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMessages).Put([]byte(key), []byte(id))
+	})
+}
+
+func (b *boltStore) AddPendingUpload(p *pb.PendingUpload) error {
+	data, err := proto.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPending).Put([]byte(p.GetReviewMessageId()), data)
+	})
+}
+
+func (b *boltStore) PendingUpload(reviewMessageID string) (*pb.PendingUpload, error) {
+	var p *pb.PendingUpload
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketPending).Get([]byte(reviewMessageID))
+		if v == nil {
+			return nil
+		}
+		p = &pb.PendingUpload{}
+		return proto.Unmarshal(v, p)
+	})
+	return p, err
+}
+
+func (b *boltStore) RemovePendingUpload(reviewMessageID string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPending).Delete([]byte(reviewMessageID))
+	})
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
+
+// itob encodes an integer as a big-endian key so keys sort numerically.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
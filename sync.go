@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	defaultSyncInterval = 600 // seconds
+	pushAttempts        = 4
+	pushBackoff         = 2 * time.Second // doubled after each attempt
+)
+
+// errPushPending means a commit was made but couldn't be pushed. It stays in
+// the local repo and the background sync keeps trying.
+var errPushPending = errors.New("committed but not pushed")
+
+// pushPendingNote is added to what we tell people when their change hit
+// errPushPending.
+const pushPendingNote = "It's committed, but I couldn't push it to the server yet. I'll keep trying, no need to upload it again."
+
+// pushWithRetry pushes the checked out branch. If that fails (usually because
+// someone else pushed first) it rebases onto upstream and tries again, waiting
+// a little longer each time.
+func pushWithRetry(git Git) error {
+	var err error
+	delay := pushBackoff
+	for attempt := 1; attempt <= pushAttempts; attempt++ {
+		err = git.Push()
+		if err == nil {
+			return nil
+		}
+		log.Printf("push attempt %d of %d failed: %v\n", attempt, pushAttempts, err)
+		if attempt == pushAttempts {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+		if rerr := git.pullRebase(); rerr != nil {
+			log.Println("unable to rebase onto upstream:", rerr)
+		}
+	}
+	return err
+}
+
+// retry calls fn until it works, waiting a little longer between each try.
+func retry(fn func() error) error {
+	var err error
+	delay := pushBackoff
+	for attempt := 1; attempt <= pushAttempts; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		log.Printf("attempt %d of %d failed: %v\n", attempt, pushAttempts, err)
+		if attempt < pushAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
+// notifyAdmins posts a message in the admin channel, if there is one.
+func notifyAdmins(s *discordgo.Session, msg string) {
+	if config.GetAdminChannel() == "" || s == nil {
+		return
+	}
+	_, err := s.ChannelMessageSend(config.GetAdminChannel(), msg)
+	if err != nil {
+		log.Println("error notifying admins:", err)
+	}
+}
+
+// runRepoSync will periodically pull upstream changes into the repo, and
+// push any commits that couldn't be pushed at the time. Runs forever.
+func runRepoSync(s *discordgo.Session) {
+	interval := config.GetSyncInterval()
+	if interval < 0 {
+		return
+	}
+	if interval == 0 {
+		interval = defaultSyncInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		// the sync has to wait for uploads like anything else, if the
+		// queue is full there's plenty going on, try next time
+		repoJobs.add(&repoJob{
+			description: "syncing with upstream",
+			run:         func() { syncRepo(s) },
+		})
+	}
+}
+
+// Whether the last sync failed, so admins are told once rather than every
+// time. Only used from the repo queue.
+var syncFailing bool
+
+// syncRepo pulls upstream changes and pushes anything left behind by
+// earlier failures, including upload branches for pull requests.
+func syncRepo(s *discordgo.Session) {
+	git := NewGit(config.GetRepoPath())
+	err := git.pullRebase()
+	if err != nil {
+		log.Println("repo sync failed:", err)
+		if !syncFailing {
+			notifyAdmins(s, fmt.Sprintf("I couldn't pull upstream changes into the map repo, it may need a hand:\n```\n%v\n```", err))
+		}
+		syncFailing = true
+		return
+	}
+	if syncFailing {
+		notifyAdmins(s, "Pulling upstream changes into the map repo is working again.")
+		syncFailing = false
+	}
+	pushPendingBranches(s, git)
+	ahead, err := git.unpushed()
+	if err != nil {
+		log.Println("unable to count unpushed commits:", err)
+		return
+	}
+	if ahead == 0 {
+		return
+	}
+	err = pushWithRetry(git)
+	if err != nil {
+		log.Printf("still unable to push %d commits: %v\n", ahead, err)
+		return
+	}
+	log.Printf("pushed %d commits left over from earlier\n", ahead)
+	notifyAdmins(s, fmt.Sprintf("The %d commits that were waiting have now been pushed.", ahead))
+}
+
+// pushPendingBranches pushes the upload branches that couldn't be pushed when
+// they were made, and opens their pull requests.
+func pushPendingBranches(s *discordgo.Session, git Git) {
+	cfg := config.GetPullRequests()
+	if cfg == nil {
+		return
+	}
+	branches, err := git.pendingBranches()
+	if err != nil {
+		log.Println("unable to list branches waiting to be pushed:", err)
+		return
+	}
+	if len(branches) == 0 {
+		return
+	}
+	forge, err := newForge(cfg)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	current, err := git.currentBranch()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, branch := range branches {
+		title, body, err := git.branchDescription(branch)
+		if err != nil {
+			// the branch is gone, nothing left to push
+			log.Printf("unable to read pending branch %q: %v\n", branch, err)
+			git.clearPending(branch)
+			continue
+		}
+		err = git.pushBranch(prRemote(cfg), branch)
+		if err != nil {
+			log.Printf("still unable to push %q: %v\n", branch, err)
+			continue
+		}
+		prURL, err := forge.OpenPullRequest(&pullRequest{
+			title: title,
+			body:  body,
+			head:  branch,
+			base:  prBase(cfg, current),
+		})
+		if err != nil {
+			// admins already know, it's tried again next time
+			log.Printf("pushed %q but still couldn't open a pull request: %v\n", branch, err)
+			continue
+		}
+		git.clearPending(branch)
+		log.Printf("opened pull request %s\n", prURL)
+		notifyAdmins(s, fmt.Sprintf("\"%s\" has now been pushed, pull request: %s", title, prURL))
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Who we've already told about, so a player sitting on a server doesn't
+// trigger a DM every poll. Keyed by user ID, then "alias/name".
+var (
+	watchSeen   = map[string]map[string]bool{}
+	watchSeenMu sync.Mutex
+
+	// held while changing a watchlist so concurrent commands from the same
+	// user don't clobber each other
+	watchlistMu sync.Mutex
+)
+
+// normalizePlayerName will make a Quake 2 player name comparable. Names can
+// contain "high-bit" characters (the same character with bit 7 set, shown
+// in a different color in game), so strip that bit, drop anything that's not
+// printable and ignore case.
+func normalizePlayerName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i] & 0x7f
+		if c < 0x20 || c == 0x7f {
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return strings.ToLower(strings.TrimSpace(b.String()))
+}
+
+// cmdWatch adds a player name to the requesting user's watchlist.
+func cmdWatch(r *commandRequest) {
+	if len(r.args) == 0 {
+		r.reply("Usage: `!q2 watch <playername>`")
+		return
+	}
+	name := normalizePlayerName(strings.Join(r.args, " "))
+	if name == "" {
+		r.reply("That's not a valid player name")
+		return
+	}
+	watchlistMu.Lock()
+	defer watchlistMu.Unlock()
+	wl, err := store.Watchlist(r.user.ID)
+	if err != nil {
+		log.Println("error reading watchlist:", err)
+		r.reply("Sorry, I couldn't read your watchlist")
+		return
+	}
+	for _, n := range wl.GetNames() {
+		if n == name {
+			r.reply(fmt.Sprintf("You're already watching for `%s`", name))
+			return
+		}
+	}
+	wl.Names = append(wl.Names, name)
+	if err := store.SetWatchlist(r.user.ID, wl); err != nil {
+		log.Println("error saving watchlist:", err)
+		r.reply("Sorry, I couldn't save your watchlist")
+		return
+	}
+	r.reply(fmt.Sprintf("OK, I'll DM you when `%s` joins a server", name))
+}
+
+// cmdUnwatch removes a player name from the requesting user's watchlist.
+func cmdUnwatch(r *commandRequest) {
+	if len(r.args) == 0 {
+		r.reply("Usage: `!q2 unwatch <playername>`")
+		return
+	}
+	name := normalizePlayerName(strings.Join(r.args, " "))
+	watchlistMu.Lock()
+	defer watchlistMu.Unlock()
+	wl, err := store.Watchlist(r.user.ID)
+	if err != nil {
+		log.Println("error reading watchlist:", err)
+		r.reply("Sorry, I couldn't read your watchlist")
+		return
+	}
+	for i, n := range wl.GetNames() {
+		if n == name {
+			wl.Names = append(wl.Names[:i], wl.Names[i+1:]...)
+			if err := store.SetWatchlist(r.user.ID, wl); err != nil {
+				log.Println("error saving watchlist:", err)
+				r.reply("Sorry, I couldn't save your watchlist")
+				return
+			}
+			r.reply(fmt.Sprintf("No longer watching for `%s`", name))
+			return
+		}
+	}
+	r.reply(fmt.Sprintf("You weren't watching for `%s`", name))
+}
+
+// cmdWatching lists the requesting user's watchlist.
+func cmdWatching(r *commandRequest) {
+	wl, err := store.Watchlist(r.user.ID)
+	if err != nil {
+		log.Println("error reading watchlist:", err)
+		r.reply("Sorry, I couldn't read your watchlist")
+		return
+	}
+	names := wl.GetNames()
+	if len(names) == 0 {
+		r.reply("You're not watching for anyone, use `!q2 watch <playername>`")
+		return
+	}
+	sort.Strings(names)
+	r.reply(fmt.Sprintf("You're watching for: `%s`", strings.Join(names, "`, `")))
+}
+
+// checkWatchlists will DM anyone watching for a player that has just shown
+// up on the polled server.
+func checkWatchlists(s *discordgo.Session, p serverPoll) {
+	if p.err != nil {
+		return
+	}
+	online := map[string]bool{}
+	for _, pl := range p.info.Players {
+		online[normalizePlayerName(pl.Name)] = true
+	}
+
+	watchlists, err := store.Watchlists()
+	if err != nil {
+		log.Println("error reading watchlists:", err)
+		return
+	}
+
+	watchSeenMu.Lock()
+	defer watchSeenMu.Unlock()
+	for user, wl := range watchlists {
+		seen, ok := watchSeen[user]
+		if !ok {
+			seen = map[string]bool{}
+			watchSeen[user] = seen
+		}
+		for _, name := range wl.GetNames() {
+			key := p.server.GetAlias() + "/" + name
+			if !online[name] {
+				delete(seen, key)
+				continue
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			msg := fmt.Sprintf("`%s` just joined **%s** (`%s`)", name, p.server.GetAlias(), p.server.GetAddress())
+			sendDM(s, user, msg)
+		}
+	}
+}
+
+// sendDM will send a private message to a user.
+func sendDM(s *discordgo.Session, userID, msg string) {
+	pm, err := s.UserChannelCreate(userID)
+	if err != nil {
+		log.Println("error creating direct message channel:", err)
+		return
+	}
+	_, err = s.ChannelMessageSend(pm.ID, msg)
+	if err != nil {
+		log.Printf("error sending DM to %s: %v\n", userID, err)
+	}
+}